@@ -4,22 +4,48 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"nfs002/template/v1/internal/db"
+	"nfs002/template/v1/internal/mail"
 	m "nfs002/template/v1/internal/models"
+	"nfs002/template/v1/internal/password"
 	u "nfs002/template/v1/internal/utils"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog/log"
 )
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port    int
+	env     string
+	baseURL string
+	db      struct {
 		dsn string
 	}
+	mail         mail.Config
+	registration struct {
+		orgID int
+		scope []string
+	}
+	login struct {
+		account    m.ThrottlePolicy
+		ip         m.ThrottlePolicy
+		trustProxy bool
+	}
+	userRetention  time.Duration
+	requireIfMatch bool
+	invitationTTL  time.Duration
+	docsPage       bool
+	totpIssuer     string
+	password       struct {
+		policy       password.Policy
+		breachedList string
+		hasher       password.Hasher
+	}
 }
 
 type application struct {
@@ -27,12 +53,24 @@ type application struct {
 	validator *validator.Validate
 	version   string
 	DB        m.DBModel
+	mailer    mail.Sender
+	passwords *password.Policy
+	hasher    *password.Hasher
 }
 
 func (app *application) serve() error {
+	handler := app.routes()
+
+	// refuse to start with routes missing from the OpenAPI specification
+	if routes, ok := handler.(chi.Routes); ok {
+		if err := checkOperations(routes); err != nil {
+			return err
+		}
+	}
+
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%d", app.config.port),
-		Handler:           app.routes(),
+		Handler:           handler,
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
 		WriteTimeout:      5 * time.Second,
@@ -44,9 +82,26 @@ func (app *application) serve() error {
 	return srv.ListenAndServe()
 }
 
-func newValidator() *validator.Validate {
+// purgeDeletedUsers permanently deletes expired soft deleted users every interval
+func (app *application) purgeDeletedUsers(interval time.Duration) {
+	for {
+		purged, err := app.DB.PurgeDeletedUsers(app.config.userRetention)
+		if err != nil {
+			u.ErrorLog("Failed to purge deleted users", err)
+		} else if purged > 0 {
+			log.Info().Int64("users", purged).Msg("Purged deleted users")
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func newValidator(passwords *password.Policy) *validator.Validate {
 	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(fieldName)
 	v.RegisterValidation("scope", u.ValidateScope)
+	v.RegisterValidation("orgscope", u.ValidateOrganizationScope)
+	v.RegisterValidation("password", passwords.Validate)
 	return v
 }
 
@@ -66,6 +121,85 @@ func Run() {
 	// Environment
 	cfg.env = u.GetEnvOrDefault("APP_ENV", "dev")
 
+	// Public URL of the API, used for links sent by email
+	cfg.baseURL = strings.TrimSuffix(u.GetEnvOrDefault("APP_URL", fmt.Sprintf("http://localhost:%d", cfg.port)), "/")
+
+	// Mail
+	cfg.mail.Transport = u.GetEnvOrDefault("MAIL_TRANSPORT", "log")
+	cfg.mail.From = u.GetEnvOrDefault("MAIL_FROM", "no-reply@example.com")
+	cfg.mail.Dir = u.GetEnvOrDefault("MAIL_DIR", "mail")
+	cfg.mail.SMTP.Host = u.GetEnvOrDefault("SMTP_HOST", "localhost")
+	cfg.mail.SMTP.Port = u.GetIntEnvOrDefault("SMTP_PORT", 587)
+	cfg.mail.SMTP.Username = os.Getenv("SMTP_USERNAME")
+	cfg.mail.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+
+	// Self-service registration
+	cfg.registration.orgID = u.GetIntEnvOrDefault("REGISTRATION_ORGANIZATION_ID", 1)
+	cfg.registration.scope = strings.Split(u.GetEnvOrDefault("REGISTRATION_SCOPE", "read:a"), ",")
+	for _, s := range cfg.registration.scope {
+		if !slices.Contains(u.OrganizationScopes, s) {
+			log.Panic().Str("scope", s).Msg("Invalid scope in REGISTRATION_SCOPE")
+		}
+	}
+
+	// Failed login throttling, per account and per source IP
+	cfg.login.account = m.ThrottlePolicy{
+		FreeAttempts: u.GetIntEnvOrDefault("LOGIN_FREE_ATTEMPTS", 3),
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Duration(u.GetIntEnvOrDefault("LOGIN_MAX_LOCKOUT_MINUTES", 15)) * time.Minute,
+		Window:       time.Hour,
+	}
+	cfg.login.ip = cfg.login.account
+	cfg.login.ip.FreeAttempts = u.GetIntEnvOrDefault("LOGIN_FREE_ATTEMPTS_PER_IP", 20)
+	cfg.login.trustProxy = u.GetBoolEnvOrDefault("TRUST_PROXY_HEADERS", false)
+
+	// How long soft deleted users can be restored for before they are purged
+	cfg.userRetention = time.Duration(u.GetIntEnvOrDefault("USER_RETENTION_DAYS", 30)) * 24 * time.Hour
+
+	// Whether user updates and deletes must be conditional on the ETag of the user
+	cfg.requireIfMatch = u.GetBoolEnvOrDefault("REQUIRE_IF_MATCH", false)
+
+	// How long invitations can be accepted for
+	cfg.invitationTTL = time.Duration(u.GetIntEnvOrDefault("INVITATION_TTL_HOURS", 72)) * time.Hour
+
+	// Whether to serve the page rendering the OpenAPI specification at /docs
+	cfg.docsPage = u.GetBoolEnvOrDefault("API_DOCS_PAGE", cfg.env == "dev")
+
+	// Name authenticator apps show for TOTP two-factor authentication
+	cfg.totpIssuer = u.GetEnvOrDefault("TOTP_ISSUER", "nfs002 template")
+
+	// Password policy
+	cfg.password.policy.MinLength = u.GetIntEnvOrDefault("PASSWORD_MIN_LENGTH", 10)
+	cfg.password.policy.MaxBytes = u.GetIntEnvOrDefault("PASSWORD_MAX_BYTES", 72)
+	cfg.password.policy.MinClasses = u.GetIntEnvOrDefault("PASSWORD_MIN_CLASSES", 2)
+	cfg.password.breachedList = os.Getenv("PASSWORD_BREACHED_LIST")
+
+	if cfg.password.breachedList != "" {
+		if err := cfg.password.policy.LoadBreached(cfg.password.breachedList); err != nil {
+			u.PanicLog("Failed to load breached password list", err)
+		}
+	}
+
+	// Password hashing, existing hashes made with other settings are rehashed on login
+	cfg.password.hasher.Algorithm = u.GetEnvOrDefault("PASSWORD_HASH_ALGORITHM", password.Argon2id)
+	cfg.password.hasher.Argon2 = password.Argon2Params{
+		Memory:      uint32(u.GetIntEnvOrDefault("ARGON2_MEMORY_KIB", 64*1024)),
+		Iterations:  uint32(u.GetIntEnvOrDefault("ARGON2_ITERATIONS", 3)),
+		Parallelism: uint8(u.GetIntEnvOrDefault("ARGON2_PARALLELISM", 2)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	cfg.password.hasher.BcryptCost = u.GetIntEnvOrDefault("BCRYPT_COST", 12)
+
+	if _, err := cfg.password.hasher.Hash(""); err != nil {
+		u.PanicLog("Invalid password hashing configuration", err)
+	}
+
+	mailer, err := mail.NewSender(cfg.mail)
+	if err != nil {
+		u.PanicLog("Failed to create mail sender", err)
+	}
+
 	conn, err := db.OpenDB(cfg.db.dsn)
 
 	if err != nil {
@@ -82,9 +216,14 @@ func Run() {
 		config:    cfg,
 		version:   u.API_VERSION,
 		DB:        m.DBModel{DB: conn},
-		validator: newValidator(),
+		validator: newValidator(&cfg.password.policy),
+		mailer:    mailer,
+		passwords: &cfg.password.policy,
+		hasher:    &cfg.password.hasher,
 	}
 
+	app.background(func() { app.purgeDeletedUsers(time.Hour) })
+
 	err = app.serve()
 	if err != nil {
 		u.PanicLog("Failed to start API server", err)
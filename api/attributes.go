@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	md "nfs002/template/v1/internal/models"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Largest attributes schema accepted
+const maxSchemaBytes = 64 << 10
+
+// compileAttributesSchema compiles a JSON schema for user attributes
+func compileAttributesSchema(raw json.RawMessage) (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("attributes.json", bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return c.Compile("attributes.json")
+}
+
+// attributesSchema loads and compiles the schema user attributes are validated against
+func (app *application) attributesSchema() (*jsonschema.Schema, error) {
+	raw, err := app.DB.GetAttributesSchema()
+	if err != nil {
+		return nil, err
+	}
+	return compileAttributesSchema(raw)
+}
+
+// validateAttributes validates user attributes against a schema. Omitted (nil)
+// attributes are left unchanged by writes, so are always valid
+func validateAttributes(schema *jsonschema.Schema, attrs md.Attributes) error {
+	if attrs == nil {
+		return nil
+	}
+
+	if err := schema.Validate(map[string]any(attrs)); err != nil {
+		var ve *jsonschema.ValidationError
+		if errors.As(err, &ve) {
+			// the innermost cause says what is actually wrong
+			for len(ve.Causes) > 0 {
+				ve = ve.Causes[0]
+			}
+			return md.NewError(md.ErrValidation, "invalid attributes: %s %s", ve.InstanceLocation, ve.Message)
+		}
+		return md.NewError(md.ErrValidation, "invalid attributes: %s", err)
+	}
+
+	return nil
+}
+
+// storedAttributes returns the attributes a user is created with: those
+// given, or an empty object if they were omitted
+func storedAttributes(attrs md.Attributes) md.Attributes {
+	if attrs == nil {
+		return md.Attributes{}
+	}
+	return attrs
+}
+
+// checkAttributes validates user attributes against the current schema, writing the
+// error response and returning false if they are invalid
+func (app *application) checkAttributes(w http.ResponseWriter, attrs md.Attributes) bool {
+	if attrs == nil {
+		return true
+	}
+
+	schema, err := app.attributesSchema()
+	if err != nil {
+		app.errorResponse(w, err)
+		return false
+	}
+
+	if err := validateAttributes(schema, attrs); err != nil {
+		app.errorResponse(w, err)
+		return false
+	}
+
+	return true
+}
+
+// GetAttributesSchema gets the JSON schema user attributes are validated against
+func (app *application) GetAttributesSchema(w http.ResponseWriter, r *http.Request) {
+	schema, err := app.DB.GetAttributesSchema()
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, schema)
+}
+
+// SetAttributesSchema replaces the JSON schema user attributes are validated against.
+// Existing attributes are only validated against it when they are next written
+func (app *application) SetAttributesSchema(w http.ResponseWriter, r *http.Request) {
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSchemaBytes))
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if !json.Valid(raw) {
+		app.badRequest(w, errors.New("body must be a JSON schema"))
+		return
+	}
+
+	if _, err := compileAttributesSchema(raw); err != nil {
+		app.badRequest(w, fmt.Errorf("invalid schema: %w", err))
+		return
+	}
+
+	if err := app.DB.SetAttributesSchema(raw); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "attributes schema succesfully updated"
+	app.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,378 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nfs002/template/v1/internal/mail"
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
+)
+
+// Largest import request body accepted
+const maxImportBytes = 10 << 20
+
+// csvFormulaPrefixes are the first characters of cells spreadsheets evaluate as formulas
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// escapeCSVCell prefixes cells which spreadsheets would evaluate as a formula with a
+// quote, so that exported values are shown as text
+func escapeCSVCell(v string) string {
+	if v != "" && strings.ContainsRune(csvFormulaPrefixes, rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// unescapeCSVCell removes the quote added by escapeCSVCell, so that exported users can
+// be imported again unchanged
+func unescapeCSVCell(v string) string {
+	if len(v) > 1 && v[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(v[1])) {
+		return v[1:]
+	}
+	return v
+}
+
+// readImportRows reads the users to import from a CSV (text/csv) or JSON array request
+// body. CSV files need a header row naming their columns, and unknown columns are ignored
+func readImportRows(w http.ResponseWriter, r *http.Request) ([]md.ImportUserRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var rows []md.ImportUserRequest
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/csv" {
+		if err := json.NewDecoder(r.Body).Decode(&rows); err != nil {
+			return nil, err
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(r.Body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("csv header has no 'email' column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		row := md.ImportUserRequest{
+			FirstName: unescapeCSVCell(field(record, "first_name")),
+			LastName:  unescapeCSVCell(field(record, "last_name")),
+			Email:     unescapeCSVCell(field(record, "email")),
+			Password:  field(record, "password"),
+			Scope:     []string{},
+		}
+
+		// scope is comma separated within its (quoted) column, like in exports
+		if scope := strings.TrimSpace(field(record, "scope")); scope != "" {
+			for _, s := range strings.Split(scope, ",") {
+				row.Scope = append(row.Scope, strings.TrimSpace(s))
+			}
+		}
+
+		// attributes are a JSON object within their (quoted) column, like in exports
+		if attrs := strings.TrimSpace(field(record, "attributes")); attrs != "" {
+			if err := json.Unmarshal([]byte(attrs), &row.Attributes); err != nil {
+				return nil, fmt.Errorf("invalid attributes of row %d: %w", len(rows)+1, err)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// hashPasswords hashes many passwords concurrently, one per CPU at a time. Empty
+// passwords are left as empty hashes, which no password matches
+func (app *application) hashPasswords(passwords []string) ([]string, error) {
+	hashes := make([]string, len(passwords))
+	errs := make([]error, len(passwords))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+
+	for i, p := range passwords {
+		if p == "" {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			hashes[i], errs[i] = app.hasher.Hash(p)
+		}()
+	}
+	wg.Wait()
+
+	return hashes, errors.Join(errs...)
+}
+
+// ImportUsers creates many users from a CSV or JSON request body. Every row is validated
+// like CreateUser, except the password is optional, before any user is created, and either
+// every user is created or none are. With '?dry_run=true' rows are only validated
+func (app *application) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	// large imports take longer than the server's default timeouts
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(time.Minute))
+	rc.SetWriteDeadline(time.Now().Add(2 * time.Minute))
+
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if t, ok := contextToken(r); ok && orgID == 0 {
+		orgID = int(t.OrganizationID)
+	}
+
+	rows, err := readImportRows(w, r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if len(rows) == 0 {
+		app.badRequest(w, errors.New("no users to import"))
+		return
+	}
+
+	schema, err := app.attributesSchema()
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	result := md.ImportResult{DryRun: r.URL.Query().Get("dry_run") == "true"}
+
+	// the errors of each row, as errors of fields of the (JSON) array of rows
+	rowErrors := make([][]fieldError, len(rows))
+	rowError := func(i int, field string, err error) {
+		path := func(field string) string {
+			if field == "" {
+				return fmt.Sprintf("rows[%d]", i)
+			}
+			return fmt.Sprintf("rows[%d].%s", i, field)
+		}
+
+		if p, ok := app.requestProblem(err); ok && len(p.Errors) > 0 {
+			for _, fe := range p.Errors {
+				fe.Field = path(fe.Field)
+				rowErrors[i] = append(rowErrors[i], fe)
+			}
+			return
+		}
+		rowErrors[i] = append(rowErrors[i], fieldError{Field: path(field), Detail: err.Error()})
+	}
+
+	seen := map[string]int{}
+	emails := make([]string, 0, len(rows))
+
+	for i := range rows {
+		u := &rows[i]
+		u.FirstName = strings.TrimSpace(u.FirstName)
+		u.LastName = strings.TrimSpace(u.LastName)
+		u.Email = strings.TrimSpace(u.Email)
+		if u.Scope == nil {
+			u.Scope = []string{}
+		}
+
+		email := strings.ToLower(u.Email)
+		emails = append(emails, email)
+
+		if err := app.validator.Struct(u); err != nil {
+			rowError(i, "", err)
+		} else if err := app.canGrantScope(r, u.Scope); err != nil {
+			rowError(i, "scope", err)
+		} else if err := validateAttributes(schema, storedAttributes(u.Attributes)); err != nil {
+			rowError(i, "attributes", err)
+		} else if first, ok := seen[email]; ok {
+			rowError(i, "email", fmt.Errorf("email address is the same as rows[%d]", first))
+		}
+
+		if _, ok := seen[email]; !ok {
+			seen[email] = i
+		}
+	}
+
+	existing, err := app.DB.ExistingEmails(emails)
+	if err != nil {
+		ut.ErrorLog("Error checking existing emails", err)
+		app.internalError(w)
+		return
+	}
+
+	for i, email := range emails {
+		if slices.Contains(existing, email) {
+			rowError(i, "email", md.ErrDuplicateEmail)
+		}
+	}
+
+	p := problem{Type: problemValidation, Title: "Request validation failed", Status: http.StatusBadRequest}
+	invalid := 0
+	for _, errs := range rowErrors {
+		if len(errs) > 0 {
+			invalid++
+			p.Errors = append(p.Errors, errs...)
+		}
+	}
+
+	if invalid > 0 {
+		p.Detail = fmt.Sprintf("%d of %d rows are invalid, no users were imported", invalid, len(rows))
+		app.writeProblem(w, p)
+		return
+	}
+
+	if result.DryRun {
+		result.Message = fmt.Sprintf("all %d rows are valid", len(rows))
+		app.writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	passwords := make([]string, 0, len(rows))
+	for _, u := range rows {
+		passwords = append(passwords, u.Password)
+	}
+
+	hashes, err := app.hashPasswords(passwords)
+	if err != nil {
+		ut.ErrorLog("Error hashing imported passwords", err)
+		app.internalError(w)
+		return
+	}
+
+	ids, err := app.DB.ImportUsers(rows, hashes, orgID)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	app.sendSetPasswordTokens(rows, ids)
+
+	result.Imported = len(rows)
+	result.Message = fmt.Sprintf("%d users succesfully imported", len(rows))
+	app.writeJSON(w, http.StatusOK, result)
+}
+
+// sendSetPasswordTokens emails a password reset token to each imported user without a
+// password, in the background. Users who don't receive one can ask for another with
+// ForgotPassword
+func (app *application) sendSetPasswordTokens(users []md.ImportUserRequest, ids []int) {
+	app.background(func() {
+		for i, u := range users {
+			if u.Password != "" {
+				continue
+			}
+
+			token, err := md.GenerateOneTimeToken(ids[i], md.PurposeResetPassword, app.config.invitationTTL)
+			if err != nil {
+				ut.ErrorLog("Error generating password token for imported user", err)
+				continue
+			}
+
+			if err := app.DB.InsertOneTimeToken(token); err != nil {
+				ut.ErrorLog("Error saving password token for imported user", err)
+				continue
+			}
+
+			msg := mail.Message{
+				To:      u.Email,
+				Subject: "Set your password",
+				Body: fmt.Sprintf("Hello %s,\r\n\r\nAn account has been created for you. Use the token below to set your password within %d hours:\r\n\r\n%s\r\n",
+					u.FirstName, int(app.config.invitationTTL.Hours()), token.PlainText),
+			}
+
+			if err := app.mailer.Send(msg); err != nil {
+				ut.ErrorLog("Error sending password token to imported user", err)
+			}
+		}
+	})
+}
+
+// ExportUsers exports every user as JSON, or as CSV with '?format=csv'
+func (app *application) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		app.badRequest(w, errors.New("invalid query parameter 'format', expected 'json' or 'csv'"))
+		return
+	}
+
+	users, err := app.DB.ExportUsers(orgID)
+	if err != nil {
+		ut.ErrorLog("Error exporting users", err)
+		app.internalError(w)
+		return
+	}
+
+	if format != "csv" {
+		headers := http.Header{}
+		headers.Set("Content-Disposition", `attachment; filename="users.json"`)
+		app.writeJSON(w, http.StatusOK, users, headers)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="users.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "first_name", "last_name", "email", "scope", "status", "attributes", "created_at"})
+	for _, u := range users {
+		attrs, _ := json.Marshal(u.Attributes)
+		out.Write([]string{
+			strconv.Itoa(u.ID),
+			escapeCSVCell(u.FirstName),
+			escapeCSVCell(u.LastName),
+			escapeCSVCell(u.Email),
+			strings.Join(u.Scope, ","),
+			u.Status,
+			string(attrs),
+			u.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	out.Flush()
+}
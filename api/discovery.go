@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	ut "nfs002/template/v1/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// routeInfo describes a registered route and the scope required to call it
+type routeInfo struct {
+	Method        string   `json:"method"`
+	Route         string   `json:"route"`
+	Authenticated bool     `json:"authenticated"`
+	Scope         []string `json:"scope"`
+
+	// handler serves the route, and names its operation in the OpenAPI specification
+	handler http.Handler
+}
+
+// routeScope finds the scope required by a chain of middlewares, by wrapping a
+// placeholder handler with each one and looking for the handler made by WithScope
+func routeScope(middlewares []func(http.Handler) http.Handler) (bool, []string) {
+	authenticated := false
+	scope := []string{}
+
+	for _, mw := range middlewares {
+		if h, ok := mw(http.NotFoundHandler()).(*scopedHandler); ok {
+			authenticated = true
+			for _, s := range h.scope {
+				if !slices.Contains(scope, s) {
+					scope = append(scope, s)
+				}
+			}
+		}
+	}
+
+	return authenticated, scope
+}
+
+// walkRoutes lists every route registered on the router, sorted by route then method
+func walkRoutes(routes chi.Routes) ([]routeInfo, error) {
+	var all []routeInfo
+
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// sub-routers serve their root ('/api/routes/') without the trailing slash too
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+
+		authenticated, scope := routeScope(middlewares)
+		all = append(all, routeInfo{
+			Method:        method,
+			Route:         route,
+			Authenticated: authenticated,
+			Scope:         scope,
+			handler:       handler,
+		})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(all, func(a, b routeInfo) int {
+		if c := strings.Compare(a.Route, b.Route); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Method, b.Method)
+	})
+
+	return all, nil
+}
+
+// scopeInfo describes a valid scope
+type scopeInfo struct {
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// GetScopes lists every valid scope with its description
+func (app *application) GetScopes(w http.ResponseWriter, r *http.Request) {
+	scopes := make([]scopeInfo, 0, len(ut.ValidScopes))
+	for _, s := range ut.ValidScopes {
+		scopes = append(scopes, scopeInfo{Scope: s, Description: ut.ScopeDescriptions[s]})
+	}
+
+	app.writeJSON(w, http.StatusOK, scopes)
+}
+
+// GetRoutes lists every route registered on the router with its method and required scope
+func (app *application) GetRoutes(w http.ResponseWriter, r *http.Request) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		app.internalError(w)
+		return
+	}
+
+	all, err := walkRoutes(rctx.Routes)
+	if err != nil {
+		ut.ErrorLog("Error walking routes", err)
+		app.internalError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, all)
+}
@@ -12,13 +12,21 @@ import (
 	ut "nfs002/template/v1/internal/utils"
 
 	"github.com/go-chi/chi/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func (app *application) CreateAuthToken(w http.ResponseWriter, r *http.Request) {
 	var input md.TokenRequest
 
+	// record the outcome of every attempt, including malformed ones, failing with an
+	// error unless a reason is set
+	event := md.LoginEvent{Reason: md.LoginError, IP: clientIP(r), UserAgent: r.UserAgent()}
+	defer func() {
+		event.Email = input.Email
+		app.recordLogin(event)
+	}()
+
 	if err := app.readJSON(w, r, &input); err != nil {
+		event.Reason = md.LoginInvalidRequest
 		app.badRequest(w, err)
 		return
 	}
@@ -28,13 +36,34 @@ func (app *application) CreateAuthToken(w http.ResponseWriter, r *http.Request)
 
 	// Validate requested scope is within user's scope
 
+	// refuse attempts while the account or source IP is locked out
+	wait, err := app.DB.GetLockout(accountThrottleKey(input.Email), ipThrottleKey(r))
+	if err != nil {
+		ut.ErrorLog("Error checking login lockout", err)
+		app.internalError(w)
+		return
+	}
+
+	if wait > 0 {
+		event.Reason = md.LoginLockedOut
+		app.tooManyRequests(w, wait)
+		return
+	}
+
 	// get the user from the database by email; send error if invalid email
 	user, err := app.DB.GetUserByEmail(input.Email)
-	if err != nil {
-		app.invalidCredentials(w, err)
+	if errors.Is(err, md.ErrNotFound) {
+		event.Reason = md.LoginUnknownEmail
+		app.recordLoginFailure(r, input.Email)
+		app.invalidCredentials(w, errors.New("invalid credentials"))
+		return
+	} else if err != nil {
+		app.errorResponse(w, err)
 		return
 	}
 
+	event.UserID = &user.ID
+
 	// validate the password; send error if invalid password
 	validPassword, err := app.passwordMatches(user.Password, input.Password)
 	if err != nil {
@@ -44,19 +73,75 @@ func (app *application) CreateAuthToken(w http.ResponseWriter, r *http.Request)
 
 	if !validPassword {
 		// if passwords not match
+		event.Reason = md.LoginWrongPassword
+		app.recordLoginFailure(r, input.Email)
 		app.invalidCredentials(w, errors.New("incorrect password"))
 		return
 	}
 
+	// upgrade hashes made with an outdated algorithm or cost while the password is known
+	if app.hasher.NeedsRehash(user.Password) {
+		if newHash, err := app.hasher.Hash(input.Password); err != nil {
+			ut.ErrorLog("Error rehashing password", err)
+		} else if err := app.DB.UpdatePasswordForUser(user.ID, newHash); err != nil {
+			ut.ErrorLog("Error saving rehashed password", err)
+		}
+	}
+
+	// self-registered users must verify their email address first
+	if user.EmailVerifiedAt == nil {
+		event.Reason = md.LoginEmailUnverified
+		app.invalidCredentials(w, errors.New("email address not verified"))
+		return
+	}
+
+	// suspended and disabled users cannot authenticate
+	if user.Status != md.StatusActive {
+		event.Reason = md.LoginInactive
+		app.invalidCredentials(w, fmt.Errorf("user account is %s", user.Status))
+		return
+	}
+
+	// get the organization the token is requested for
+	membership, err := app.DB.GetMembershipForUser(user.ID, input.OrganizationID)
+	if err != nil {
+		event.Reason = md.LoginNoMembership
+		app.errorResponse(w, err)
+		return
+	}
+
 	// Validate if the user has scope to request the token scope
-	if err := user.CanRequestScope(input.Scope); err != nil {
-		app.badRequest(w, err)
+	if err := user.CanRequestScope(input.Scope, membership); err != nil {
+		event.Reason = md.LoginScopeDenied
+		app.errorResponse(w, err)
+		return
+	}
+
+	// validate the one time password of users with two-factor authentication. A wrong
+	// one time password counts as a failed login, so it can't be guessed either
+	err = app.checkSecondFactor(user, input, membership.OrganizationID)
+	if errors.Is(err, errOTPRequired) || errors.Is(err, errInvalidOTP) {
+		event.Reason = md.LoginSecondFactor
+		app.recordLoginFailure(r, input.Email)
+		app.invalidCredentials(w, err)
+		return
+	} else if errors.Is(err, md.ErrForbidden) {
+		event.Reason = md.LoginSecondFactor
+		app.errorResponse(w, err)
+		return
+	} else if err != nil {
+		app.errorResponse(w, err)
 		return
 	}
 
+	// only clear failed logins once every factor is valid
+	if err := app.DB.ClearLoginFailures(accountThrottleKey(input.Email)); err != nil {
+		ut.ErrorLog("Error clearing failed logins", err)
+	}
+
 	// generate the token
 	ttl := (1 * time.Hour) + (time.Duration(input.Expiry) * time.Minute)
-	token, err := md.GenerateToken(user.ID, ttl, input.Scope)
+	token, err := md.GenerateToken(user.ID, membership.OrganizationID, ttl, input.Scope)
 	if err != nil {
 		app.internalError(w)
 		return
@@ -68,6 +153,8 @@ func (app *application) CreateAuthToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	event.Success, event.Reason = true, ""
+
 	// send response
 	var payload struct {
 		Error   bool      `json:"error"`
@@ -100,7 +187,11 @@ func (app *application) authenticateToken(r *http.Request, scope []string) (*md.
 
 	// get the user from the tokens table
 	user, token, err := app.DB.GetUserForToken(tokenStr)
-	if err != nil {
+	// the messages of typed errors, such as for inactive users, are safe to show
+	var modelErr *md.Error
+	if errors.As(err, &modelErr) {
+		return nil, nil, err
+	} else if err != nil {
 		return nil, nil, errors.New("no matching user found")
 	}
 
@@ -126,8 +217,7 @@ func (app *application) Hello(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) HelloUser(w http.ResponseWriter, r *http.Request) {
 	// validate the token, and get associated user
-	key := requestContextKey{Key: "user"}
-	u, ok := r.Context().Value(key).(*md.User)
+	u, ok := contextUser(r)
 	if !ok {
 		app.internalError(w)
 		return
@@ -145,13 +235,82 @@ func (app *application) HelloUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	allUsers, err := app.DB.GetAllUsers()
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	q, err := app.readUsersQuery(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	page, err := app.DB.GetAllUsers(orgID, q)
 	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	// link to the next page with the same query
+	if page.NextCursor != "" {
+		next := r.URL.Query()
+		next.Set("cursor", page.NextCursor)
+		page.Next = r.URL.Path + "?" + next.Encode()
+	}
+
+	app.writeJSON(w, http.StatusOK, page)
+}
+
+// SearchUsers searches users by partial name or email address with '?q=', ranked by
+// how well they match, and returns a page of them like GetAllUsers
+func (app *application) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	rep, err := app.readUserRepresentation(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	q := md.SearchUsersRequest{
+		UserRepresentation: rep,
+		Query:              strings.TrimSpace(r.URL.Query().Get("q")),
+		Limit:              25,
+		Cursor:             r.URL.Query().Get("cursor"),
+	}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			app.badRequest(w, errors.New("invalid query parameter 'limit'"))
+			return
+		}
+	}
+
+	if err := app.validator.Struct(q); err != nil {
 		app.badRequest(w, err)
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, allUsers)
+	page, err := app.DB.SearchUsers(orgID, q)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	// link to the next page with the same query
+	if page.NextCursor != "" {
+		next := r.URL.Query()
+		next.Set("cursor", page.NextCursor)
+		page.Next = r.URL.Path + "?" + next.Encode()
+	}
+
+	app.writeJSON(w, http.StatusOK, page)
 }
 
 // GetOneUser gets one user by id (from the url) and returns it as JSON
@@ -159,18 +318,32 @@ func (app *application) GetOneUser(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	userID, _ := strconv.Atoi(id)
 
-	user, err := app.DB.GetOneUser(userID)
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	rep, err := app.readUserRepresentation(r)
 	if err != nil {
 		app.badRequest(w, err)
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, user)
+	user, err := app.DB.GetOneUser(userID, orgID, rep)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", userETag(user.Version))
+	app.writeJSON(w, http.StatusOK, user, headers)
 }
 
 func (app *application) CreateUser(w http.ResponseWriter, r *http.Request) {
 
-	var user md.User
+	var user md.CreateUserRequest
 
 	err := app.readJSON(w, r, &user)
 	if err != nil {
@@ -178,15 +351,35 @@ func (app *application) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
+	if err := app.canGrantScope(r, user.Scope); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	if !app.checkAttributes(w, storedAttributes(user.Attributes)) {
+		return
+	}
 
+	// new users join the caller's organization, unless a super-admin names another
+	orgID, err := app.organizationFilter(r)
 	if err != nil {
 		app.badRequest(w, err)
 		return
 	}
 
-	if err = app.DB.AddUser(user, string(hash)); err != nil {
-		app.internalError(w)
+	if t, ok := contextToken(r); ok && orgID == 0 {
+		orgID = int(t.OrganizationID)
+	}
+
+	hash, err := app.hasher.Hash(user.Password)
+
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if err = app.DB.AddUser(user, hash, orgID); err != nil {
+		app.errorResponse(w, err)
 		return
 	}
 
@@ -200,6 +393,8 @@ func (app *application) CreateUser(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, resp)
 }
 
+// UpdateUser replaces a user by id (from the url). Every field of the user must be
+// given, as for PATCH with a merge patch of every field
 func (app *application) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	userID, err := strconv.Atoi(id)
@@ -207,38 +402,72 @@ func (app *application) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if userID <= 0 || err != nil {
 		ut.ErrorLog("Error parsing 'id' parameter", err)
 		app.badRequest(w, errors.New("invalid request parameter 'UserID'"))
+		return
 	}
 
-	var user md.UpdateUserRequest
+	var user md.ReplaceUserRequest
 
 	if err := app.readJSON(w, r, &user); err != nil {
 		app.badRequest(w, err)
 		return
 	}
 
-	if user.Trim(); user.IsEmpty() {
-		app.badRequest(w, errors.New("nothing to update"))
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
 		return
 	}
 
-	// Update an existing user
-	if err := app.DB.EditUser(userID, user); err != nil {
-		ut.ErrorLog("Error updating user", err)
+	version, err := app.readIfMatch(r)
+	if errors.Is(err, md.ErrPrecondition) {
+		app.errorResponse(w, err)
+		return
+	} else if err != nil {
 		app.badRequest(w, err)
 		return
 	}
 
-	if user.Password != "" {
-		newHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
-		if err != nil {
-			app.internalError(w)
+	app.replaceUser(w, r, userID, orgID, user, version)
+}
+
+// replaceUser replaces a user, with their password and scope if given, unless it changed
+// since version, and writes the response
+func (app *application) replaceUser(w http.ResponseWriter, r *http.Request, userID, orgID int, user md.ReplaceUserRequest, version *int) {
+	// scope is held per organization, so a super-admin must name one to change it
+	if user.Scope != nil {
+		if orgID == 0 {
+			app.badRequest(w, errors.New("query parameter 'organization_id' is required to update scope"))
+			return
+		}
+
+		if err := app.canGrantScope(r, user.Scope); err != nil {
+			app.errorResponse(w, err)
 			return
 		}
+	}
+
+	// replacing without attributes clears them
+	if user.Attributes == nil {
+		user.Attributes = md.Attributes{}
+	}
+
+	if !app.checkAttributes(w, user.Attributes) {
+		return
+	}
 
-		if err := app.DB.UpdatePasswordForUser(userID, user, string(newHash)); err != nil {
+	var hash string
+	if user.Password != "" {
+		newHash, err := app.hasher.Hash(user.Password)
+		if err != nil {
 			app.internalError(w)
 			return
 		}
+		hash = newHash
+	}
+
+	if err := app.DB.ReplaceUser(userID, orgID, user, hash, version); err != nil {
+		app.errorResponse(w, err)
+		return
 	}
 
 	var resp struct {
@@ -251,7 +480,8 @@ func (app *application) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, resp)
 }
 
-// DeleteUser deletes a user, and all associated tokens, from the database
+// DeleteUser soft deletes a user, and deletes all associated tokens, from the database.
+// Users who are also members of other organizations are only removed from the caller's
 func (app *application) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	userID, err := strconv.Atoi(id)
@@ -262,12 +492,27 @@ func (app *application) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := app.DB.DeleteUser(userID); err != nil {
-		ut.ErrorLog("Error deleting user", err)
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	version, err := app.readIfMatch(r)
+	if errors.Is(err, md.ErrPrecondition) {
+		app.errorResponse(w, err)
+		return
+	} else if err != nil {
 		app.badRequest(w, err)
 		return
 	}
 
+	removed, err := app.DB.DeleteUser(userID, orgID, version)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
 	var resp struct {
 		Error   bool   `json:"error"`
 		Message string `json:"message"`
@@ -275,5 +520,79 @@ func (app *application) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	resp.Error = false
 	resp.Message = "succesfully deleted user"
+	if removed {
+		resp.Message = "user is also a member of other organizations, so was only removed from this one"
+	}
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// RestoreUser restores a soft deleted user that has not yet been purged
+func (app *application) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(id)
+
+	if userID <= 0 || err != nil {
+		ut.ErrorLog("Error parsing 'id' parameter", err)
+		app.badRequest(w, errors.New("invalid request parameter 'UserID'"))
+		return
+	}
+
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if err := app.DB.RestoreUser(userID, orgID); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "succesfully restored user"
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// SetUserStatus changes the status of a user (by id from the url), with a reason
+func (app *application) SetUserStatus(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(id)
+
+	if userID <= 0 || err != nil {
+		ut.ErrorLog("Error parsing 'id' parameter", err)
+		app.badRequest(w, errors.New("invalid request parameter 'UserID'"))
+		return
+	}
+
+	var input md.SetUserStatusRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if err := app.DB.SetUserStatus(userID, orgID, input.Status, strings.TrimSpace(input.Reason)); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = fmt.Sprintf("user status succesfully set to %s", input.Status)
 	app.writeJSON(w, http.StatusOK, resp)
 }
@@ -4,9 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
 )
 
 // writeJSON writes arbitrary data out as JSON
@@ -23,14 +28,17 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data interf
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	w.WriteHeader(status)
 	w.Write(out)
 
 	return nil
 }
 
-// readJSON reads json from request body into data, We only accept a single json value in the body
+// readJSON reads json from request body into data, We only accept a single json value in the body.
+// Request types with a Trim method are trimmed before they are validated
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	maxBytes := 1048576
 
@@ -42,6 +50,11 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data in
 		return err
 	}
 
+	// trim whitespace first, so that blank required fields fail validation
+	if t, ok := data.(interface{ Trim() }); ok {
+		t.Trim()
+	}
+
 	// Validate request
 	if err := app.validator.Struct(data); err != nil {
 		return err
@@ -50,63 +63,207 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data in
 	return nil
 }
 
-func (app *application) badRequest(w http.ResponseWriter, err error) error {
-	var payload struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
+// readUserRepresentation reads the '?fields=' sparse fieldset and '?include=' embeds
+// of a request for users, both comma separated
+func (app *application) readUserRepresentation(r *http.Request) (md.UserRepresentation, error) {
+	var rep md.UserRepresentation
+
+	list := func(key string) []string {
+		var out []string
+		for _, v := range strings.Split(r.URL.Query().Get(key), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+		return out
 	}
 
-	payload.Error = true
-	payload.Message = err.Error()
+	rep.Fields = list("fields")
+	rep.Include = list("include")
 
-	er := app.writeJSON(w, http.StatusBadRequest, payload)
-	if er != nil {
-		return er
+	if err := app.validator.Struct(rep); err != nil {
+		return rep, err
 	}
-	return nil
+
+	return rep, nil
 }
 
-func (app *application) invalidCredentials(w http.ResponseWriter, err error) error {
-	var payload struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
+// readUsersQuery reads the pagination, filter and sort query parameters for listing users
+func (app *application) readUsersQuery(r *http.Request) (md.ListUsersRequest, error) {
+	qs := r.URL.Query()
+
+	rep, err := app.readUserRepresentation(r)
+	if err != nil {
+		return md.ListUsersRequest{}, err
 	}
 
-	payload.Error = true
-	payload.Message = fmt.Sprintf("Unauthorised: %s", err.Error())
+	q := md.ListUsersRequest{
+		UserRepresentation: rep,
+		Limit:              25,
+		Cursor:             qs.Get("cursor"),
+		Email:              qs.Get("email"),
+		Scope:              qs.Get("scope"),
+		Sort:               "name",
+		Order:              "asc",
+	}
 
-	if err := app.writeJSON(w, http.StatusUnauthorized, payload); err != nil {
-		return err
+	if v := qs.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return q, errors.New("invalid query parameter 'limit'")
+		}
+		q.Limit = limit
 	}
-	return nil
+
+	if v := qs.Get("sort"); v != "" {
+		q.Sort = v
+	}
+
+	if v := qs.Get("order"); v != "" {
+		q.Order = v
+	}
+
+	for key, dst := range map[string]**time.Time{"created_after": &q.CreatedAfter, "created_before": &q.CreatedBefore} {
+		if v := qs.Get(key); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("invalid query parameter '%s', expected RFC 3339 time", key)
+			}
+			*dst = &t
+		}
+	}
+
+	for key, values := range qs {
+		if name, ok := strings.CutPrefix(key, "attr."); ok && name != "" {
+			if q.Attributes == nil {
+				q.Attributes = map[string]string{}
+			}
+			q.Attributes[name] = values[0]
+		}
+	}
+
+	if err := app.validator.Struct(q); err != nil {
+		return q, err
+	}
+
+	return q, nil
 }
 
-func (app *application) internalError(w http.ResponseWriter) error {
-	var payload struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
+// badRequest tells the client their request is invalid, with the errors of each field
+// for validation and JSON decoding errors
+func (app *application) badRequest(w http.ResponseWriter, err error) error {
+	if p, ok := app.requestProblem(err); ok {
+		return app.writeProblem(w, p)
 	}
 
-	payload.Error = true
-	payload.Message = "something went wrong"
+	return app.writeProblem(w, newProblem(http.StatusBadRequest, err.Error()))
+}
 
-	err := app.writeJSON(w, http.StatusInternalServerError, payload)
-	if err != nil {
-		return err
+func (app *application) invalidCredentials(w http.ResponseWriter, err error) error {
+	return app.writeProblem(w, newProblem(http.StatusUnauthorized, err.Error()))
+}
+
+// conflict tells the client the request conflicts with the current state of a resource
+func (app *application) conflict(w http.ResponseWriter, err error) error {
+	return app.writeProblem(w, newProblem(http.StatusConflict, err.Error()))
+}
+
+// tooManyRequests tells the client to retry after wait
+func (app *application) tooManyRequests(w http.ResponseWriter, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+
+	headers := http.Header{}
+	headers.Set("Retry-After", strconv.Itoa(seconds))
+
+	p := newProblem(http.StatusTooManyRequests, fmt.Sprintf("too many failed attempts, try again in %d seconds", seconds))
+	return app.writeProblem(w, p, headers)
+}
+
+func (app *application) internalError(w http.ResponseWriter) error {
+	return app.writeProblem(w, newProblem(http.StatusInternalServerError, "something went wrong"))
+}
+
+// errorResponse tells the client why a request failed, by the kind of error returned by
+// the models. Unexpected errors are logged and hidden from the client
+func (app *application) errorResponse(w http.ResponseWriter, err error) error {
+	var status int
+
+	switch {
+	case errors.Is(err, md.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, md.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, md.ErrValidation):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, md.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, errPreconditionRequired):
+		status = http.StatusPreconditionRequired
+	case errors.Is(err, md.ErrPrecondition):
+		status = http.StatusPreconditionFailed
+	default:
+		ut.ErrorLog("Unexpected error handling request", err)
+		return app.internalError(w)
 	}
-	return nil
+
+	return app.writeProblem(w, newProblem(status, err.Error()))
 }
 
+// passwordMatches checks a password against a hash made by any supported algorithm
 func (app *application) passwordMatches(hash, password string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
+	return app.hasher.Verify(hash, password)
+}
+
+// background runs fn in a new goroutine, recovering and logging any panic
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				ut.ErrorLog("Recovered from panic in background task", fmt.Errorf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// userETag returns the entity tag of a user's current version
+func userETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// readIfMatch reads the user version a write is conditional on from the If-Match header.
+// It returns nil if the header is absent or '*', which matches any existing user
+func (app *application) readIfMatch(r *http.Request) (*int, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		if v == "" && app.config.requireIfMatch {
+			return nil, errPreconditionRequired
 		}
+		return nil, nil
+	}
+
+	// weak tags never match, and only a single tag can be checked atomically
+	if strings.HasPrefix(v, "W/") {
+		return nil, md.ErrPreconditionFailed
 	}
 
-	return true, nil
+	if len(v) < 2 || !strings.HasPrefix(v, `"`) || !strings.HasSuffix(v, `"`) {
+		return nil, errors.New("invalid header 'If-Match', expected a single ETag")
+	}
+
+	version, err := strconv.Atoi(v[1 : len(v)-1])
+	if err != nil {
+		return nil, errors.New("invalid header 'If-Match', expected a single ETag")
+	}
+
+	return &version, nil
+}
+
+// errPreconditionRequired is returned for writes without If-Match when it is required
+var errPreconditionRequired error = &md.Error{Kind: md.ErrPrecondition, Message: "header 'If-Match' is required, with the ETag of the user"}
+
+// unsupportedMediaType tells the client the request body is in a format not accepted
+func (app *application) unsupportedMediaType(w http.ResponseWriter, err error) error {
+	return app.writeProblem(w, newProblem(http.StatusUnsupportedMediaType, err.Error()))
 }
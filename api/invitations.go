@@ -0,0 +1,186 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"nfs002/template/v1/internal/mail"
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateInvitation invites a new user to the caller's organization (or the one named by a
+// super-admin) with a preassigned scope, and emails them a single use invite link. The
+// invitee sets their own password when accepting
+func (app *application) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var input md.CreateInvitationRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if input.Scope == nil {
+		input.Scope = []string{}
+	}
+
+	if err := app.canGrantScope(r, input.Scope); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if t, ok := contextToken(r); ok && orgID == 0 {
+		orgID = int(t.OrganizationID)
+	}
+
+	inviter, ok := contextUser(r)
+	if !ok {
+		app.internalError(w)
+		return
+	}
+
+	inv, err := md.GenerateInvitation(orgID, inviter.ID, input, app.config.invitationTTL)
+	if err != nil {
+		app.internalError(w)
+		return
+	}
+
+	// the invitation is only saved once it is sent, so a failure to send it doesn't
+	// leave behind a pending invitation nobody received
+	err = app.DB.InsertInvitation(inv, func(inv *md.Invitation) error {
+		msg := mail.Message{
+			To:      inv.Email,
+			Subject: "You have been invited",
+			Body: fmt.Sprintf("Hello,\r\n\r\n%s %s has invited you to create an account. Accept the invitation and choose your password by visiting the link below within %d hours:\r\n\r\n%s/api/invitations/accept?token=%s\r\n\r\nIf you weren't expecting this invitation, you can ignore this email.\r\n",
+				inviter.FirstName, inviter.LastName, int(app.config.invitationTTL.Hours()), app.config.baseURL, inv.PlainText),
+		}
+
+		if err := app.mailer.Send(msg); err != nil {
+			return fmt.Errorf("error sending invitation email: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, inv)
+}
+
+// GetInvitations gets every invitation of the caller's organization, or of every
+// organization for super-admins
+func (app *application) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	invitations, err := app.DB.GetInvitations(orgID)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, invitations)
+}
+
+// RevokeInvitation revokes a pending invitation by id (from the url), so it can no
+// longer be accepted
+func (app *application) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	invitationID, err := strconv.Atoi(id)
+
+	if invitationID <= 0 || err != nil {
+		ut.ErrorLog("Error parsing 'id' parameter", err)
+		app.badRequest(w, errors.New("invalid request parameter 'InvitationID'"))
+		return
+	}
+
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if err := app.DB.RevokeInvitation(invitationID, orgID); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "invitation succesfully revoked"
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// GetInvitation gets a pending invitation by its invite token (from the query string),
+// so the invitee can be shown who they are joining as before accepting
+func (app *application) GetInvitation(w http.ResponseWriter, r *http.Request) {
+	tokenStr := r.URL.Query().Get("token")
+	if len(tokenStr) != 26 {
+		app.badRequest(w, errors.New("invalid query parameter 'token'"))
+		return
+	}
+
+	inv, err := app.DB.GetInvitationByToken(tokenStr)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	// the invitee doesn't need to know who else is in the organization
+	inv.InvitedBy = nil
+	app.writeJSON(w, http.StatusOK, inv)
+}
+
+// AcceptInvitation creates the invited user with the password they chose, consuming
+// the invite token
+func (app *application) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var input md.AcceptInvitationRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	// invited users have no attributes, which the schema may not allow
+	if !app.checkAttributes(w, md.Attributes{}) {
+		return
+	}
+
+	hash, err := app.hasher.Hash(input.Password)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if _, err := app.DB.AcceptInvitation(input, hash); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "invitation succesfully accepted, you can now log in"
+	app.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Longest email address, user agent and source IP recorded for a token request, the
+// sizes of their columns
+const (
+	maxLoginEmailLength = 255
+	maxUserAgentLength  = 255
+	maxIPLength         = 64
+)
+
+// recordLogin records a token request in the login history. Values longer than their
+// columns are truncated, so that every attempt is recorded
+func (app *application) recordLogin(event md.LoginEvent) {
+	if len(event.Email) > maxLoginEmailLength {
+		event.Email = strings.ToValidUTF8(event.Email[:maxLoginEmailLength], "")
+	}
+
+	if len(event.UserAgent) > maxUserAgentLength {
+		event.UserAgent = strings.ToValidUTF8(event.UserAgent[:maxUserAgentLength], "")
+	}
+
+	if len(event.IP) > maxIPLength {
+		event.IP = strings.ToValidUTF8(event.IP[:maxIPLength], "")
+	}
+
+	if err := app.DB.InsertLoginEvent(event); err != nil {
+		ut.ErrorLog("Error recording login", err)
+	}
+}
+
+// readLoginsQuery reads the pagination query parameters for listing token requests
+func (app *application) readLoginsQuery(r *http.Request) (md.ListLoginsRequest, error) {
+	q := md.ListLoginsRequest{
+		Limit:  25,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return q, errors.New("invalid query parameter 'limit'")
+		}
+		q.Limit = limit
+	}
+
+	if err := app.validator.Struct(q); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+// writeLogins writes a page of the token requests of a user, with a link to the next page
+func (app *application) writeLogins(w http.ResponseWriter, r *http.Request, userID int) {
+	q, err := app.readLoginsQuery(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	page, err := app.DB.GetLoginEvents(userID, q)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	if page.NextCursor != "" {
+		next := r.URL.Query()
+		next.Set("cursor", page.NextCursor)
+		page.Next = r.URL.Path + "?" + next.Encode()
+	}
+
+	app.writeJSON(w, http.StatusOK, page)
+}
+
+// GetUserLogins gets the login history of a user by id (from the url), newest first
+func (app *application) GetUserLogins(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(id)
+
+	if userID <= 0 || err != nil {
+		ut.ErrorLog("Error parsing 'id' parameter", err)
+		app.badRequest(w, errors.New("invalid request parameter 'UserID'"))
+		return
+	}
+
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	// only users of the caller's organization
+	if _, err := app.DB.GetOneUser(userID, orgID, md.UserRepresentation{Fields: []string{"id"}}); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	app.writeLogins(w, r, userID)
+}
+
+// GetMyLogins gets the login history of the authenticated user, newest first
+func (app *application) GetMyLogins(w http.ResponseWriter, r *http.Request) {
+	u, ok := contextUser(r)
+	if !ok {
+		app.internalError(w)
+		return
+	}
+
+	app.writeLogins(w, r, u.ID)
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
+)
+
+// GetMe gets the profile of the authenticated user
+func (app *application) GetMe(w http.ResponseWriter, r *http.Request) {
+	u, uok := contextUser(r)
+	t, tok := contextToken(r)
+	if !uok || !tok {
+		app.internalError(w)
+		return
+	}
+
+	profile, err := app.DB.GetProfile(u.ID)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	profile.OrganizationID = t.OrganizationID
+	profile.Scope = t.Scope
+	if profile.Scope == nil {
+		profile.Scope = []string{}
+	}
+
+	app.writeJSON(w, http.StatusOK, profile)
+}
+
+// UpdateMe updates the name and attributes of the authenticated user
+func (app *application) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	u, ok := contextUser(r)
+	if !ok {
+		app.internalError(w)
+		return
+	}
+
+	var input md.UpdateProfileRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if input.IsEmpty() {
+		app.badRequest(w, errors.New("nothing to update"))
+		return
+	}
+
+	if !app.checkAttributes(w, input.Attributes) {
+		return
+	}
+
+	update := md.UpdateUserRequest{
+		FirstName:  input.FirstName,
+		LastName:   input.LastName,
+		Attributes: input.Attributes,
+	}
+
+	if err := app.DB.EditUser(u.ID, 0, update, nil); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "profile succesfully updated"
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// ChangeMyPassword changes the password of the authenticated user, who must confirm
+// their current password. Every other token of the user is revoked, while the token
+// used for the request keeps working. Wrong passwords count as failed logins, so a
+// stolen token can't be used to guess the password
+func (app *application) ChangeMyPassword(w http.ResponseWriter, r *http.Request) {
+	u, uok := contextUser(r)
+	t, tok := contextToken(r)
+	if !uok || !tok {
+		app.internalError(w)
+		return
+	}
+
+	var input md.ChangePasswordRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	wait, err := app.DB.GetLockout(accountThrottleKey(u.Email), ipThrottleKey(r))
+	if err != nil {
+		ut.ErrorLog("Error checking login lockout", err)
+		app.internalError(w)
+		return
+	}
+
+	if wait > 0 {
+		app.tooManyRequests(w, wait)
+		return
+	}
+
+	// the user in the request context has no password hash
+	user, err := app.DB.GetUserByEmail(u.Email)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	validPassword, err := app.passwordMatches(user.Password, input.CurrentPassword)
+	if err != nil {
+		app.internalError(w)
+		return
+	}
+
+	if !validPassword {
+		app.recordLoginFailure(r, u.Email)
+		app.invalidCredentials(w, errors.New("incorrect password"))
+		return
+	}
+
+	hash, err := app.hasher.Hash(input.NewPassword)
+	if err != nil {
+		app.internalError(w)
+		return
+	}
+
+	if err := app.DB.UpdatePasswordForUser(u.ID, hash); err != nil {
+		ut.ErrorLog("Error changing password", err)
+		app.internalError(w)
+		return
+	}
+
+	if err := app.DB.DeleteOtherTokensForUser(u.ID, t.ID); err != nil {
+		ut.ErrorLog("Error deleting tokens after password change", err)
+		app.internalError(w)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "password succesfully changed"
+	app.writeJSON(w, http.StatusOK, resp)
+}
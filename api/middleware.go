@@ -2,27 +2,105 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
+
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
 )
 
 type requestContextKey struct {
 	Key string `json:"key"`
 }
 
+// scopedHandler authenticates a request with the required scope before passing it to
+// next. The scope is kept on the handler so it can be discovered by walking the router
+type scopedHandler struct {
+	app   *application
+	scope []string
+	next  http.Handler
+}
+
+func (h *scopedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, t, err := h.app.authenticateToken(r, h.scope)
+	if err != nil {
+		h.app.invalidCredentials(w, err)
+		return
+	}
+
+	// Add user  and token to context
+	ctx := context.WithValue(r.Context(), requestContextKey{Key: "user"}, u)
+	ctx = context.WithValue(ctx, requestContextKey{Key: "token"}, t)
+	r2 := r.WithContext(ctx)
+	h.next.ServeHTTP(w, r2)
+}
+
 func (app *application) WithScope(scope []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			u, t, err := app.authenticateToken(r, scope)
-			if err != nil {
-				app.invalidCredentials(w, err)
-				return
-			}
-
-			// Add user  and token to context
-			ctx := context.WithValue(r.Context(), requestContextKey{Key: "user"}, u)
-			ctx = context.WithValue(ctx, requestContextKey{Key: "token"}, t)
-			r2 := r.WithContext(ctx)
-			next.ServeHTTP(w, r2)
-		})
+		return &scopedHandler{app: app, scope: scope, next: next}
 	}
 }
+
+// contextUser returns the user added to the request context by WithScope
+func contextUser(r *http.Request) (*md.User, bool) {
+	u, ok := r.Context().Value(requestContextKey{Key: "user"}).(*md.User)
+	return u, ok
+}
+
+// contextToken returns the token added to the request context by WithScope
+func contextToken(r *http.Request) (*md.Token, bool) {
+	t, ok := r.Context().Value(requestContextKey{Key: "token"}).(*md.Token)
+	return t, ok
+}
+
+// organizationFilter returns the organization an authenticated request is restricted to.
+// Callers holding the super-admin scope are not restricted (0) unless they narrow the
+// request with the 'organization_id' query parameter
+func (app *application) organizationFilter(r *http.Request) (int, error) {
+	t, ok := contextToken(r)
+	if !ok {
+		return 0, errors.New("no token in request context")
+	}
+
+	if t.HasScope([]string{ut.SUPER_ADMIN_SCOPE}) != nil {
+		return int(t.OrganizationID), nil
+	}
+
+	if id := r.URL.Query().Get("organization_id"); id != "" {
+		orgID, err := strconv.Atoi(id)
+		if orgID <= 0 || err != nil {
+			return 0, errors.New("invalid query parameter 'organization_id'")
+		}
+		return orgID, nil
+	}
+
+	return 0, nil
+}
+
+// canGrantScope checks the caller is allowed to grant scope within an organization.
+// Callers may only grant scope their own token holds, unless they hold the super-admin
+// scope, which itself can never be granted within an organization
+func (app *application) canGrantScope(r *http.Request, scope []string) error {
+	t, ok := contextToken(r)
+	if !ok {
+		return errors.New("no token in request context")
+	}
+
+	if slices.Contains(scope, ut.SUPER_ADMIN_SCOPE) {
+		return md.NewError(md.ErrForbidden, "scope '%s' cannot be granted within an organization", ut.SUPER_ADMIN_SCOPE)
+	}
+
+	if t.HasScope([]string{ut.SUPER_ADMIN_SCOPE}) == nil {
+		return nil
+	}
+
+	for _, s := range scope {
+		if !slices.Contains(t.Scope, s) {
+			return md.NewError(md.ErrForbidden, "cannot grant scope '%s' which is not held by the caller", s)
+		}
+	}
+
+	return nil
+}
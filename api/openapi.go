@@ -0,0 +1,477 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"nfs002/template/v1/internal/password"
+	ut "nfs002/template/v1/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// docsPage is the page rendering the OpenAPI specification, served at /docs
+//
+//go:embed docs.html
+var docsPage []byte
+
+// object is a JSON object of the OpenAPI specification
+type object = map[string]any
+
+var pathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// schemaGenerator generates JSON schemas of Go types. Named struct types are added to
+// the schema components and referenced, anonymous types are inlined
+type schemaGenerator struct {
+	passwords  *password.Policy
+	components object
+}
+
+// componentName returns the name of the schema component of a named type
+func componentName(t reflect.Type) string {
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// schema returns the schema of values of t
+func (g *schemaGenerator) schema(t reflect.Type) object {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return object{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return object{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return object{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t, false)
+		}
+
+		name := componentName(t)
+		if _, ok := g.components[name]; !ok {
+			// reserve the name first, in case the type refers to itself
+			g.components[name] = object{}
+			g.components[name] = g.object(t, false)
+		}
+		return object{"$ref": "#/components/schemas/" + name}
+	}
+
+	return object{}
+}
+
+// patchSchema returns the schema of JSON merge patches of t, a named struct type. Every
+// field is optional, and fields not required by t can be cleared with null
+func (g *schemaGenerator) patchSchema(t reflect.Type) object {
+	name := componentName(t) + "Patch"
+	if _, ok := g.components[name]; !ok {
+		g.components[name] = g.object(t, true)
+	}
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// structFields returns the exported fields of a struct, including those of embedded structs
+func structFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, structFields(f.Type)...)
+		} else if f.IsExported() && f.Tag.Get("json") != "-" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// object returns the schema of a struct, with the constraints of its 'validate' tags
+func (g *schemaGenerator) object(t reflect.Type, patch bool) object {
+	properties := object{}
+	required := []string{}
+
+	for _, f := range structFields(t) {
+		name := fieldName(f)
+		s, isRequired := g.field(f)
+
+		switch {
+		case patch && !isRequired:
+			s = object{"anyOf": []any{s, object{"type": "null"}}}
+		case !patch && isRequired:
+			required = append(required, name)
+		case !patch && f.Type.Kind() == reflect.Pointer:
+			s = nullable(s)
+		}
+
+		properties[name] = s
+	}
+
+	s := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// nullable allows a schema to also be null
+func nullable(s object) object {
+	if typ, ok := s["type"].(string); ok {
+		s["type"] = []string{typ, "null"}
+		return s
+	}
+	return object{"anyOf": []any{s, object{"type": "null"}}}
+}
+
+// field returns the schema of a struct field and whether it is required
+func (g *schemaGenerator) field(f reflect.StructField) (object, bool) {
+	s := g.schema(f.Type)
+	tag := f.Tag.Get("validate")
+	if tag == "" {
+		return s, false
+	}
+
+	isRequired, dived, keys := false, false, false
+	target := s
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+
+		switch {
+		case name == "keys" || name == "endkeys":
+			// the rules of map keys have no equivalent
+			keys = name == "keys"
+		case keys:
+		case name == "required":
+			isRequired = isRequired || !dived
+		case name == "dive":
+			// the following rules apply to the items of arrays and the values of maps
+			dived = true
+			if items, ok := target["items"].(object); ok {
+				target = items
+			} else if values, ok := target["additionalProperties"].(object); ok {
+				target = values
+			}
+		default:
+			g.constrain(target, name, param)
+		}
+	}
+
+	return s, isRequired
+}
+
+// constrain adds the constraint of a validation rule to a schema. Rules without an
+// equivalent, such as alternatives ('len=0|email'), are left out
+func (g *schemaGenerator) constrain(s object, name, param string) {
+	n, _ := strconv.ParseFloat(param, 64)
+
+	var typ string
+	switch v := s["type"].(type) {
+	case string:
+		typ = v
+	case []string:
+		typ = v[0]
+	}
+
+	lengths := map[string][2]string{
+		"string": {"minLength", "maxLength"},
+		"array":  {"minItems", "maxItems"},
+		"object": {"minProperties", "maxProperties"},
+	}
+
+	switch name {
+	case "email":
+		s["format"] = "email"
+	case "url":
+		s["format"] = "uri"
+	case "oneof":
+		s["enum"] = strings.Fields(param)
+	case "scope":
+		s["enum"] = ut.ValidScopes[:]
+	case "orgscope":
+		s["enum"] = ut.OrganizationScopes
+	case "password":
+		s["minLength"] = g.passwords.MinLength
+		s["description"] = "must satisfy the password policy"
+	case "len":
+		if l, ok := lengths[typ]; ok {
+			s[l[0]], s[l[1]] = n, n
+		}
+	case "min", "max", "gte", "lte", "gt", "lt":
+		if l, ok := lengths[typ]; ok {
+			if name == "min" || name == "gte" {
+				s[l[0]] = n
+			} else if name == "max" || name == "lte" {
+				s[l[1]] = n
+			}
+			return
+		}
+
+		key := map[string]string{
+			"min": "minimum", "gte": "minimum", "gt": "exclusiveMinimum",
+			"max": "maximum", "lte": "maximum", "lt": "exclusiveMaximum",
+		}[name]
+		s[key] = n
+	}
+}
+
+// parameters returns the query parameters read into a struct, named like validation
+// errors. Maps have no single parameter, so are left to the operation's description
+func (g *schemaGenerator) parameters(v any) []any {
+	params := []any{}
+	if v == nil {
+		return params
+	}
+
+	for _, f := range structFields(reflect.TypeOf(v)) {
+		if f.Type.Kind() == reflect.Map {
+			continue
+		}
+
+		s, isRequired := g.field(f)
+		p := object{"name": fieldName(f), "in": "query", "required": isRequired, "schema": s}
+
+		// lists are comma separated
+		if f.Type.Kind() == reflect.Slice {
+			p["style"], p["explode"] = "form", false
+		}
+
+		params = append(params, p)
+	}
+
+	return params
+}
+
+// operationIDs names operations after their handlers, numbering handlers of several routes
+type operationIDs map[string]int
+
+func (ids operationIDs) next(h http.Handler) string {
+	name := "operation"
+	if fn := runtime.FuncForPC(reflect.ValueOf(h).Pointer()); fn != nil {
+		name = fn.Name()
+		name = name[strings.LastIndex(name, ".")+1:]
+		name = strings.TrimSuffix(name, "-fm")
+	}
+
+	ids[name]++
+	if n := ids[name]; n > 1 {
+		return name + strconv.Itoa(n)
+	}
+	return name
+}
+
+// checkOperations checks every route registered on the router is documented by an entry
+// of operations, so that none is missing its request and response schemas
+func checkOperations(routes chi.Routes) error {
+	all, err := walkRoutes(routes)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, ri := range all {
+		if _, ok := operations[ri.Method+" "+ri.Route]; !ok {
+			missing = append(missing, ri.Method+" "+ri.Route)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("routes without an OpenAPI operation: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// openAPI generates the OpenAPI specification of every route registered on the router
+func (app *application) openAPI(routes chi.Routes) (object, error) {
+	g := &schemaGenerator{passwords: app.passwords, components: object{}}
+	problemSchema := g.schema(reflect.TypeOf(problem{}))
+	ids := operationIDs{}
+	paths := object{}
+
+	all, err := walkRoutes(routes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ri := range all {
+		method, route := ri.Method, ri.Route
+		doc := operations[method+" "+route]
+
+		params := []any{}
+		for _, m := range pathParam.FindAllStringSubmatch(route, -1) {
+			params = append(params, object{"name": m[1], "in": "path", "required": true, "schema": object{"type": "integer"}})
+		}
+
+		params = append(params, g.parameters(doc.Query)...)
+
+		if doc.Organization {
+			params = append(params, object{
+				"name":        "organization_id",
+				"in":          "query",
+				"description": "The organization to act in, for callers with the super-admin scope",
+				"schema":      object{"type": "integer", "minimum": 1},
+			})
+		}
+
+		if doc.Conditional {
+			params = append(params, object{
+				"name":        "If-Match",
+				"in":          "header",
+				"description": "The ETag of the version of the user the write is based on",
+				"schema":      object{"type": "string"},
+			})
+		}
+
+		responses := object{
+			"default": object{
+				"description": "Error",
+				"content":     object{"application/problem+json": object{"schema": problemSchema}},
+			},
+		}
+
+		response := doc.Response
+		if response == nil && len(doc.ResponseTypes) == 0 {
+			response = messageResponse{}
+		}
+
+		content := object{}
+		if response != nil {
+			content["application/json"] = object{"schema": g.schema(reflect.TypeOf(response))}
+		}
+		for _, mediaType := range doc.ResponseTypes {
+			content[mediaType] = object{"schema": object{"type": "string"}}
+		}
+
+		ok := object{"description": "OK", "content": content}
+		if doc.ETag {
+			ok["headers"] = object{"ETag": object{
+				"description": "The version of the user, for If-Match",
+				"schema":      object{"type": "string"},
+			}}
+		}
+		responses["200"] = ok
+
+		op := object{
+			"operationId": ids.next(ri.handler),
+			"summary":     doc.Summary,
+			"parameters":  params,
+			"responses":   responses,
+		}
+
+		if doc.Description != "" {
+			op["description"] = doc.Description
+		}
+
+		// operations are grouped by the first segment of their path, after '/api'
+		tag, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(route, "/api"), "/"), "/")
+		op["tags"] = []string{tag}
+
+		if ri.Authenticated {
+			op["security"] = []any{object{"bearerAuth": ri.Scope}}
+		}
+
+		if doc.Request != nil {
+			requestTypes := doc.RequestTypes
+			if len(requestTypes) == 0 {
+				requestTypes = []string{"application/json"}
+			}
+
+			content := object{}
+			for _, mediaType := range requestTypes {
+				switch mediaType {
+				case "application/json":
+					content[mediaType] = object{"schema": g.schema(reflect.TypeOf(doc.Request))}
+				case mergePatchType:
+					content[mediaType] = object{"schema": g.patchSchema(reflect.TypeOf(doc.Request))}
+				default:
+					content[mediaType] = object{"schema": object{"type": "string"}}
+				}
+			}
+
+			op["requestBody"] = object{"required": true, "content": content}
+		}
+
+		path := pathParam.ReplaceAllString(route, "{$1}")
+		if _, ok := paths[path]; !ok {
+			paths[path] = object{}
+		}
+		paths[path].(object)[strings.ToLower(method)] = op
+	}
+
+	scopes := make([]string, 0, len(ut.ValidScopes))
+	for _, s := range ut.ValidScopes {
+		scopes = append(scopes, "- `"+s+"`: "+ut.ScopeDescriptions[s])
+	}
+	slices.Sort(scopes)
+
+	spec := object{
+		"openapi": "3.1.0",
+		"info": object{
+			"title":   "nfs002 template API",
+			"version": app.version,
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": g.components,
+			"securitySchemes": object{
+				"bearerAuth": object{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A token from `POST /api/authenticate`. Operations list the scopes the token must hold:\n\n" + strings.Join(scopes, "\n"),
+				},
+			},
+		},
+	}
+
+	return spec, nil
+}
+
+// GetOpenAPI returns the OpenAPI specification of the API, generated from the router
+func (app *application) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		app.internalError(w)
+		return
+	}
+
+	spec, err := app.openAPI(rctx.Routes)
+	if err != nil {
+		ut.ErrorLog("Error generating OpenAPI specification", err)
+		app.internalError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, spec)
+}
+
+// GetDocs serves a page rendering the OpenAPI specification, where requests can be tried out
+func (app *application) GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
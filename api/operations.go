@@ -0,0 +1,318 @@
+package api
+
+import (
+	md "nfs002/template/v1/internal/models"
+)
+
+// operation documents a route in the OpenAPI specification. Every route must have one,
+// which is checked by checkOperations when the server starts
+type operation struct {
+	Summary     string
+	Description string
+
+	// Query is a struct whose fields are read from query parameters
+	Query any
+
+	// Organization is set for routes restricted to the caller's organization, which
+	// super-admins choose with '?organization_id='
+	Organization bool
+
+	// Conditional is set for writes which can be made conditional with If-Match, and
+	// ETag for reads returning the version to make them conditional on
+	Conditional bool
+	ETag        bool
+
+	// Request is the request body, in RequestTypes (JSON unless given)
+	Request      any
+	RequestTypes []string
+
+	// Response is the JSON body of successful responses, which are also available in
+	// ResponseTypes. Without either, the body is a message
+	Response      any
+	ResponseTypes []string
+}
+
+// messageResponse is the body of successful responses without any other content
+type messageResponse struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+}
+
+// tokenResponse is the body of successful token requests
+type tokenResponse struct {
+	Error   bool      `json:"error"`
+	Message string    `json:"message"`
+	Token   *md.Token `json:"authentication_token"`
+}
+
+// totpEnrollmentResponse is the body of successful TOTP enrollments
+type totpEnrollmentResponse struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+	Secret  string `json:"secret"`
+	URI     string `json:"uri"`
+}
+
+// recoveryCodesResponse is the body of successful TOTP confirmations
+type recoveryCodesResponse struct {
+	Error         bool     `json:"error"`
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// organizationCreatedResponse is the body of successful organization creations
+type organizationCreatedResponse struct {
+	Error          bool   `json:"error"`
+	Message        string `json:"message"`
+	OrganizationID int    `json:"organization_id"`
+}
+
+// twoFactorPolicyResponse is the body of two-factor policies
+type twoFactorPolicyResponse struct {
+	Scope []string `json:"scope" validate:"dive,scope"`
+}
+
+// tokenQuery is the query of routes consuming a token sent by email
+type tokenQuery struct {
+	Token string `query:"token" validate:"required,len=26"`
+}
+
+// importQuery is the query of importing users
+type importQuery struct {
+	DryRun bool `query:"dry_run"`
+}
+
+// exportQuery is the query of exporting users
+type exportQuery struct {
+	Format string `query:"format" validate:"omitempty,oneof=json csv"`
+}
+
+// sparseUsers describes the representation of users chosen with '?fields=' and '?include='
+const sparseUsers = "Only the fields named by `fields` are returned, all of them by default. `include=tokens` embeds the tokens of each user."
+
+// operations documents the routes of the API, by method and route pattern
+var operations = map[string]operation{
+	"GET /hello": {
+		Summary: "Say hello, without authentication",
+	},
+	"POST /api/authenticate": {
+		Summary:     "Request an authentication token",
+		Description: "Users with two-factor authentication enabled must send `otp`. Failed attempts are throttled per account and source IP.",
+		Request:     md.TokenRequest{},
+		Response:    tokenResponse{},
+	},
+	"GET /api/scopes": {
+		Summary:  "List every valid scope",
+		Response: []scopeInfo{},
+	},
+	"POST /api/register": {
+		Summary: "Register a new user, who must verify their email address",
+		Request: md.RegisterRequest{},
+	},
+	"GET /api/register/verify": {
+		Summary: "Verify an email address with the token sent to it",
+		Query:   tokenQuery{},
+	},
+	"POST /api/password/forgot": {
+		Summary: "Email a password reset token",
+		Request: md.ForgotPasswordRequest{},
+	},
+	"POST /api/password/reset": {
+		Summary: "Reset a password with a password reset token",
+		Request: md.ResetPasswordRequest{},
+	},
+	"GET /api/invitations/accept": {
+		Summary:  "Get a pending invitation by its invite token",
+		Query:    tokenQuery{},
+		Response: md.Invitation{},
+	},
+	"POST /api/invitations/accept": {
+		Summary: "Accept an invitation, creating the invited user",
+		Request: md.AcceptInvitationRequest{},
+	},
+	"GET /api/hello-user": {
+		Summary: "Say hello to the authenticated user",
+	},
+	"POST /api/2fa/enroll": {
+		Summary:  "Generate a TOTP secret for two-factor authentication",
+		Response: totpEnrollmentResponse{},
+	},
+	"POST /api/2fa/confirm": {
+		Summary:  "Enable two-factor authentication with a code from an authenticator app",
+		Request:  md.OTPRequest{},
+		Response: recoveryCodesResponse{},
+	},
+	"POST /api/2fa/disable": {
+		Summary: "Disable two-factor authentication",
+		Request: md.OTPRequest{},
+	},
+	"GET /api/me": {
+		Summary:  "Get the profile of the authenticated user",
+		Response: md.ProfileResponse{},
+	},
+	"PATCH /api/me": {
+		Summary: "Update the name and attributes of the authenticated user",
+		Request: md.UpdateProfileRequest{},
+	},
+	"POST /api/me/password": {
+		Summary:     "Change the password of the authenticated user",
+		Description: "Every other token of the user is revoked.",
+		Request:     md.ChangePasswordRequest{},
+	},
+	"GET /api/me/logins": {
+		Summary:  "List the token requests of the authenticated user, newest first",
+		Query:    md.ListLoginsRequest{},
+		Response: md.LoginPage{},
+	},
+	"GET /api/read-a/hello-user": {
+		Summary: "Say hello to a user holding the read:a scope",
+	},
+	"GET /api/read-a-write-a/hello-user": {
+		Summary: "Say hello to a user holding the read:a and write:a scopes",
+	},
+	"GET /api/admin/hello-user": {
+		Summary: "Say hello to an admin",
+	},
+	"GET /api/admin/users": {
+		Summary:      "List users",
+		Description:  sparseUsers + " Users can also be filtered by exact attribute values with `attr.<name>=<value>`.",
+		Query:        md.ListUsersRequest{},
+		Organization: true,
+		Response:     md.UserPage{},
+	},
+	"POST /api/admin/users": {
+		Summary:      "Create a user",
+		Organization: true,
+		Request:      md.CreateUserRequest{},
+	},
+	"POST /api/admin/users/import": {
+		Summary:      "Import users from JSON or CSV",
+		Description:  "Every row is validated before any user is created, and either every user is created or none are. Users without a password are emailed a password reset token to set one.",
+		Query:        importQuery{},
+		Organization: true,
+		Request:      []md.ImportUserRequest{},
+		RequestTypes: []string{"application/json", "text/csv"},
+		Response:     md.ImportResult{},
+	},
+	"GET /api/admin/users/export": {
+		Summary:       "Export users as JSON or CSV",
+		Query:         exportQuery{},
+		Organization:  true,
+		Response:      []md.ExportedUser{},
+		ResponseTypes: []string{"text/csv"},
+	},
+	"GET /api/admin/users/search": {
+		Summary:      "Search users by partial name or email address, best matches first",
+		Description:  sparseUsers,
+		Query:        md.SearchUsersRequest{},
+		Organization: true,
+		Response:     md.UserPage{},
+	},
+	"GET /api/admin/users/{id}": {
+		Summary:      "Get a user",
+		Description:  sparseUsers,
+		Query:        md.UserRepresentation{},
+		Organization: true,
+		ETag:         true,
+		Response:     md.GetUserResponse{},
+	},
+	"PUT /api/admin/users/{id}": {
+		Summary:      "Replace a user",
+		Description:  "Only a super-admin can change the account of a user who is also a member of other organizations, other than their scope within this one.",
+		Organization: true,
+		Conditional:  true,
+		Request:      md.ReplaceUserRequest{},
+	},
+	"PATCH /api/admin/users/{id}": {
+		Summary:      "Update a user with a JSON merge patch",
+		Description:  "Only a super-admin can change the account of a user who is also a member of other organizations, other than their scope within this one.",
+		Organization: true,
+		Conditional:  true,
+		Request:      md.ReplaceUserRequest{},
+		RequestTypes: []string{mergePatchType},
+	},
+	"DELETE /api/admin/users/{id}": {
+		Summary:      "Soft delete a user, who can be restored until they are purged",
+		Description:  "Users who are also members of other organizations are only removed from this one.",
+		Organization: true,
+		Conditional:  true,
+	},
+	"POST /api/admin/users/{id}/unlock": {
+		Summary:      "Clear the failed logins of a user",
+		Organization: true,
+	},
+	"POST /api/admin/users/{id}/restore": {
+		Summary:      "Restore a soft deleted user",
+		Organization: true,
+	},
+	"PUT /api/admin/users/{id}/status": {
+		Summary:      "Set the status of a user",
+		Description:  "Only a super-admin can set the status of a user who is also a member of other organizations.",
+		Organization: true,
+		Request:      md.SetUserStatusRequest{},
+	},
+	"GET /api/admin/users/{id}/logins": {
+		Summary:      "List the token requests of a user, newest first",
+		Query:        md.ListLoginsRequest{},
+		Organization: true,
+		Response:     md.LoginPage{},
+	},
+	"GET /api/admin/invitations": {
+		Summary:      "List invitations",
+		Organization: true,
+		Response:     []md.Invitation{},
+	},
+	"POST /api/admin/invitations": {
+		Summary:      "Invite a user, emailing them an invite link",
+		Organization: true,
+		Request:      md.CreateInvitationRequest{},
+		Response:     md.Invitation{},
+	},
+	"DELETE /api/admin/invitations/{id}": {
+		Summary:      "Revoke a pending invitation",
+		Organization: true,
+	},
+	"GET /api/admin/2fa-policy": {
+		Summary:      "Get the scopes which require two-factor authentication",
+		Organization: true,
+		Response:     twoFactorPolicyResponse{},
+	},
+	"PUT /api/admin/2fa-policy": {
+		Summary:      "Set the scopes which require two-factor authentication",
+		Organization: true,
+		Request:      md.TwoFactorPolicyRequest{},
+	},
+	"GET /api/routes": {
+		Summary:  "List every route with its required scope",
+		Response: []routeInfo{},
+	},
+	"GET /api/organizations": {
+		Summary:  "List organizations",
+		Response: []md.Organization{},
+	},
+	"POST /api/organizations": {
+		Summary:  "Create an organization",
+		Request:  md.CreateOrganizationRequest{},
+		Response: organizationCreatedResponse{},
+	},
+	"POST /api/organizations/{id}/members": {
+		Summary: "Add a user to an organization, or change their scope within it",
+		Request: md.AddMembershipRequest{},
+	},
+	"GET /api/settings/attributes-schema": {
+		Summary:  "Get the JSON schema user attributes are validated against",
+		Response: map[string]any{},
+	},
+	"PUT /api/settings/attributes-schema": {
+		Summary: "Replace the JSON schema user attributes are validated against",
+		Request: map[string]any{},
+	},
+	"GET /openapi.json": {
+		Summary:  "Get this OpenAPI specification",
+		Response: map[string]any{},
+	},
+	"GET /docs": {
+		Summary:       "Browse this OpenAPI specification",
+		ResponseTypes: []string{"text/html"},
+	},
+}
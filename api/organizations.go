@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetAllOrganizations returns every organization as JSON
+func (app *application) GetAllOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := app.DB.GetAllOrganizations()
+	if err != nil {
+		ut.ErrorLog("Error getting organizations", err)
+		app.internalError(w)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, orgs)
+}
+
+// CreateOrganization creates a new, empty organization
+func (app *application) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var input md.CreateOrganizationRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	orgID, err := app.DB.AddOrganization(strings.TrimSpace(input.Name))
+	if err != nil {
+		ut.ErrorLog("Error creating organization", err)
+		app.internalError(w)
+		return
+	}
+
+	var resp struct {
+		Error          bool   `json:"error"`
+		Message        string `json:"message"`
+		OrganizationID int    `json:"organization_id"`
+	}
+
+	resp.Error = false
+	resp.Message = "organization succesfully created"
+	resp.OrganizationID = orgID
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// AddMember adds an existing user to an organization (from the url) with the requested scope
+func (app *application) AddMember(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	orgID, err := strconv.Atoi(id)
+
+	if orgID <= 0 || err != nil {
+		ut.ErrorLog("Error parsing 'id' parameter", err)
+		app.badRequest(w, errors.New("invalid request parameter 'OrganizationID'"))
+		return
+	}
+
+	var input md.AddMembershipRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if err := app.canGrantScope(r, input.Scope); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	if err := app.DB.AddMembership(orgID, input.UserID, strings.Join(input.Scope, ",")); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "user succesfully added to organization"
+	app.writeJSON(w, http.StatusOK, resp)
+}
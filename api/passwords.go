@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"nfs002/template/v1/internal/mail"
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
+)
+
+// ForgotPassword emails a single use password reset token to a user. The response is
+// the same whether or not the email address belongs to a user, and the token is sent
+// in the background so response times don't reveal it either
+func (app *application) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input md.ForgotPasswordRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	app.background(func() {
+		user, err := app.DB.GetUserByEmail(input.Email)
+		if errors.Is(err, md.ErrNotFound) {
+			return
+		} else if err != nil {
+			ut.ErrorLog("Error getting user for password reset", err)
+			return
+		}
+
+		token, err := md.GenerateOneTimeToken(user.ID, md.PurposeResetPassword, 30*time.Minute)
+		if err != nil {
+			ut.ErrorLog("Error generating password reset token", err)
+			return
+		}
+
+		if err := app.DB.InsertOneTimeToken(token); err != nil {
+			ut.ErrorLog("Error saving password reset token", err)
+			return
+		}
+
+		msg := mail.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hello %s,\r\n\r\nUse the token below to reset your password within 30 minutes:\r\n\r\n%s\r\n\r\nIf you didn't ask to reset your password, you can ignore this email.\r\n",
+				user.FirstName, token.PlainText),
+		}
+
+		if err := app.mailer.Send(msg); err != nil {
+			ut.ErrorLog("Error sending password reset email", err)
+		}
+	})
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = fmt.Sprintf("if %s belongs to a user, a password reset token has been sent to it", input.Email)
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// ResetPassword consumes a password reset token, sets the user's new password and
+// invalidates all of the user's existing tokens
+func (app *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input md.ResetPasswordRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	userID, err := app.DB.ConsumeOneTimeToken(input.Token, md.PurposeResetPassword)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	hash, err := app.hasher.Hash(input.Password)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if err := app.DB.UpdatePasswordForUser(userID, hash); err != nil {
+		ut.ErrorLog("Error resetting password", err)
+		app.internalError(w)
+		return
+	}
+
+	// the old password may have been compromised, so log out everywhere
+	if err := app.DB.DeleteTokensForUser(userID); err != nil {
+		ut.ErrorLog("Error deleting tokens after password reset", err)
+		app.internalError(w)
+		return
+	}
+
+	if err := app.DB.DeleteOneTimeTokens(userID, md.PurposeResetPassword); err != nil {
+		ut.ErrorLog("Error deleting password reset tokens", err)
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "password succesfully reset"
+	app.writeJSON(w, http.StatusOK, resp)
+}
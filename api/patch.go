@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Media type of JSON merge patches (RFC 7396)
+const mergePatchType = "application/merge-patch+json"
+
+// Fields of a user which can't be cleared with null
+var nonNullUserFields = []string{"first_name", "last_name", "email", "password", "tokens"}
+
+// mergePatch applies a JSON merge patch to a decoded JSON document (RFC 7396). Members of
+// the patch replace those of the target, recursively for objects, and null removes them
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+
+	return t
+}
+
+// PatchUser updates a user by id (from the url) with a JSON merge patch. Omitted fields
+// are unchanged, null clears attributes (or a single attribute) and scope, and the result
+// is validated and written like PUT. Unless If-Match names a version, the patch is only
+// written if the user is unchanged since it was read to apply the patch
+func (app *application) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(id)
+
+	if userID <= 0 || err != nil {
+		ut.ErrorLog("Error parsing 'id' parameter", err)
+		app.badRequest(w, errors.New("invalid request parameter 'UserID'"))
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != mergePatchType {
+		app.unsupportedMediaType(w, fmt.Errorf("expected Content-Type '%s'", mergePatchType))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	var patch map[string]any
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		app.badRequest(w, errors.New("body must be a JSON merge patch object"))
+		return
+	}
+
+	for _, field := range nonNullUserFields {
+		if v, ok := patch[field]; ok && v == nil {
+			app.badRequest(w, fmt.Errorf("'%s' cannot be cleared", field))
+			return
+		}
+	}
+
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	version, err := app.readIfMatch(r)
+	if errors.Is(err, md.ErrPrecondition) {
+		app.errorResponse(w, err)
+		return
+	} else if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	current, err := app.DB.GetOneUser(userID, orgID, md.UserRepresentation{
+		Fields: []string{"first_name", "last_name", "email", "attributes"},
+	})
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	if version == nil {
+		version = &current.Version
+	}
+
+	// scope, password and tokens are write-only, so only come from the patch
+	target := map[string]any{
+		"first_name": current.FirstName,
+		"last_name":  current.LastName,
+		"email":      current.Email,
+		"attributes": map[string]any(current.Attributes),
+	}
+
+	// a null scope clears it, as an empty array does with PUT
+	if v, ok := patch["scope"]; ok && v == nil {
+		patch["scope"] = []any{}
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		app.internalError(w)
+		return
+	}
+
+	var user md.ReplaceUserRequest
+
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&user); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	// trim first, so that blank required fields fail validation
+	user.Trim()
+	if err := app.validator.Struct(user); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	app.replaceUser(w, r, userID, orgID, user, version)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Types of problems with their own documented meaning. Other problems are 'about:blank',
+// meaning nothing more than their HTTP status
+const (
+	problemValidation  = "/problems/validation"
+	problemInvalidBody = "/problems/invalid-body"
+)
+
+// problem is an RFC 7807 problem details response
+type problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Errors []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError is a problem with a single field of a request. Field is the JSON path of
+// the field (or the query parameter), and Offset the byte offset of JSON syntax errors
+type fieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+	Offset *int64 `json:"offset,omitempty"`
+}
+
+// String describes a field error on its own, naming the field unless the detail
+// already starts with its name (like the errors of the password policy)
+func (fe fieldError) String() string {
+	name := fe.Field[strings.LastIndex(fe.Field, ".")+1:]
+	if name == "" || strings.HasPrefix(fe.Detail, name+" ") {
+		return fe.Detail
+	}
+	return fmt.Sprintf("'%s' %s", fe.Field, fe.Detail)
+}
+
+// newProblem returns an 'about:blank' problem for a status
+func newProblem(status int, detail string) problem {
+	return problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// writeProblem writes a problem as application/problem+json
+func (app *application) writeProblem(w http.ResponseWriter, p problem, headers ...http.Header) error {
+	h := http.Header{}
+	if len(headers) > 0 {
+		h = headers[0].Clone()
+	}
+	h.Set("Content-Type", "application/problem+json")
+
+	return app.writeJSON(w, p.Status, p, h)
+}
+
+// fieldName returns the name of a struct field in validation errors: its JSON name, the
+// query parameter it is read from (a 'query' tag), or its name in snake case
+func fieldName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+
+	if name := f.Tag.Get("query"); name != "" {
+		return name
+	}
+
+	// embedded structs are named by their type, which is dropped from field paths
+	if f.Anonymous {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, r := range f.Name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fieldPath returns the path of the field of a validation error, without the names of
+// the request type and of embedded structs (the only capitalized segments)
+func fieldPath(fe validator.FieldError) string {
+	var path []string
+	for _, s := range strings.Split(fe.Namespace(), ".")[1:] {
+		if s != "" && !unicode.IsUpper(rune(s[0])) {
+			path = append(path, s)
+		}
+	}
+	return strings.Join(path, ".")
+}
+
+// fieldDetail explains why a field failed validation
+func (app *application) fieldDetail(fe validator.FieldError) string {
+	kind := fe.Kind()
+	isString := kind == reflect.String
+	isList := kind == reflect.Slice || kind == reflect.Map
+
+	switch tag := fe.Tag(); {
+	case tag == "required":
+		return "is required"
+	case strings.Contains(tag, "email"):
+		return "must be a valid email address"
+	case tag == "password":
+		if err := app.passwords.Check(fe.Value().(string)); err != nil {
+			return err.Error()
+		}
+		return "does not satisfy the password policy"
+	case tag == "scope":
+		return fmt.Sprintf("'%v' is not a valid scope", fe.Value())
+	case tag == "orgscope":
+		return fmt.Sprintf("'%v' is not a valid scope within an organization", fe.Value())
+	case tag == "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case (tag == "max" || tag == "lte") && isString:
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case (tag == "max" || tag == "lte") && isList:
+		return fmt.Sprintf("must have at most %s items", fe.Param())
+	case tag == "max" || tag == "lte":
+		return "must be at most " + fe.Param()
+	case (tag == "min" || tag == "gte") && isString:
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case tag == "min" || tag == "gte":
+		return "must be at least " + fe.Param()
+	case tag == "gt":
+		return "must be greater than " + fe.Param()
+	case tag == "len" && isString:
+		return fmt.Sprintf("must be exactly %s characters long", fe.Param())
+	default:
+		return fmt.Sprintf("failed the '%s' validation", tag)
+	}
+}
+
+// jsonType returns the JSON type Go values of a type are decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a number"
+	}
+}
+
+// requestProblem translates validation and JSON decoding errors into a problem with the
+// errors of each field, returning false for other errors
+func (app *application) requestProblem(err error) (problem, bool) {
+	var validationErrs validator.ValidationErrors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	p := problem{Status: http.StatusBadRequest, Type: problemInvalidBody, Title: "Request body is not valid JSON"}
+
+	switch {
+	case errors.As(err, &validationErrs):
+		p.Type, p.Title = problemValidation, "Request validation failed"
+		for _, fe := range validationErrs {
+			p.Errors = append(p.Errors, fieldError{Field: fieldPath(fe), Detail: app.fieldDetail(fe)})
+		}
+		p.Detail = fmt.Sprintf("%d fields failed validation", len(p.Errors))
+		if len(p.Errors) == 1 {
+			p.Detail = p.Errors[0].String()
+		}
+	case errors.As(err, &syntaxErr):
+		p.Detail = fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)
+		p.Errors = []fieldError{{Field: "", Detail: syntaxErr.Error(), Offset: &syntaxErr.Offset}}
+	case errors.As(err, &typeErr):
+		p.Detail = fmt.Sprintf("'%s' must be %s", typeErr.Field, jsonType(typeErr.Type))
+		p.Errors = []fieldError{{Field: typeErr.Field, Detail: "must be " + jsonType(typeErr.Type), Offset: &typeErr.Offset}}
+	case errors.As(err, &maxBytesErr):
+		p.Detail = fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit)
+	case errors.Is(err, io.EOF):
+		p.Detail = "request body must not be empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		p.Detail = "request body ends with incomplete JSON"
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		p.Detail = fmt.Sprintf("unknown field '%s'", field)
+		p.Errors = []fieldError{{Field: field, Detail: "is not a known field"}}
+	default:
+		return p, false
+	}
+
+	return p, true
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"nfs002/template/v1/internal/mail"
+	md "nfs002/template/v1/internal/models"
+)
+
+// Register creates a new user with an unverified email address and the default
+// registration scope, and emails them a link to verify their email address. The user
+// is not created if the email can't be sent
+func (app *application) Register(w http.ResponseWriter, r *http.Request) {
+	var input md.RegisterRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	// registered users have no attributes, which the schema may not allow
+	if !app.checkAttributes(w, md.Attributes{}) {
+		return
+	}
+
+	hash, err := app.hasher.Hash(input.Password)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	user := md.CreateUserRequest{
+		FirstName: strings.TrimSpace(input.FirstName),
+		LastName:  strings.TrimSpace(input.LastName),
+		Email:     strings.TrimSpace(input.Email),
+		Scope:     app.config.registration.scope,
+	}
+
+	// the user is only saved once the verification email is sent, so a failure to send
+	// it doesn't leave behind an account which can neither log in nor register again
+	err = app.DB.RegisterUser(user, hash, app.config.registration.orgID, 24*time.Hour, func(token *md.OneTimeToken) error {
+		msg := mail.Message{
+			To:      user.Email,
+			Subject: "Verify your email address",
+			Body: fmt.Sprintf("Hello %s,\r\n\r\nPlease verify your email address by visiting the link below within 24 hours:\r\n\r\n%s/api/register/verify?token=%s\r\n",
+				user.FirstName, app.config.baseURL, token.PlainText),
+		}
+
+		if err := app.mailer.Send(msg); err != nil {
+			return fmt.Errorf("error sending verification email: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = fmt.Sprintf("verification email sent to %s", user.Email)
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// VerifyEmail consumes a verification token (from the query string) and marks its
+// user's email address as verified
+func (app *application) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	tokenStr := r.URL.Query().Get("token")
+	if len(tokenStr) != 26 {
+		app.badRequest(w, errors.New("invalid query parameter 'token'"))
+		return
+	}
+
+	userID, err := app.DB.ConsumeOneTimeToken(tokenStr, md.PurposeVerifyEmail)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	if err := app.DB.VerifyEmail(userID); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "email address succesfully verified"
+	app.writeJSON(w, http.StatusOK, resp)
+}
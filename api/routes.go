@@ -15,12 +15,18 @@ func (app *application) routes() http.Handler {
 	// CORS Middleware
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match"},
+		ExposedHeaders:   []string{"ETag"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
+	// Use X-Forwarded-For/X-Real-IP as the client address when behind a proxy
+	if app.config.login.trustProxy {
+		mux.Use(middleware.RealIP)
+	}
+
 	if app.config.env == "dev" {
 		u.InfoLog("Using request logging middlware")
 		mux.Use(middleware.Logger)
@@ -28,10 +34,29 @@ func (app *application) routes() http.Handler {
 
 	mux.Get("/hello", app.Hello)
 	mux.Post("/api/authenticate", app.CreateAuthToken)
+	mux.Get("/api/scopes", app.GetScopes)
+	mux.Post("/api/register", app.Register)
+	mux.Get("/api/register/verify", app.VerifyEmail)
+	mux.Post("/api/password/forgot", app.ForgotPassword)
+	mux.Post("/api/password/reset", app.ResetPassword)
+	mux.Get("/api/invitations/accept", app.GetInvitation)
+	mux.Post("/api/invitations/accept", app.AcceptInvitation)
+	mux.Get("/openapi.json", app.GetOpenAPI)
+
+	if app.config.docsPage {
+		mux.Get("/docs", app.GetDocs)
+	}
 
 	mux.Route("/api", func(mux chi.Router) {
 		mux.Use(app.WithScope(nil))
 		mux.Get("/hello-user", app.HelloUser)
+		mux.Post("/2fa/enroll", app.EnrollTOTP)
+		mux.Post("/2fa/confirm", app.ConfirmTOTP)
+		mux.Post("/2fa/disable", app.DisableTOTP)
+		mux.Get("/me", app.GetMe)
+		mux.Patch("/me", app.UpdateMe)
+		mux.Post("/me/password", app.ChangeMyPassword)
+		mux.Get("/me/logins", app.GetMyLogins)
 	})
 
 	mux.Route("/api/read-a", func(mux chi.Router) {
@@ -50,10 +75,42 @@ func (app *application) routes() http.Handler {
 		mux.Get("/hello-user", app.HelloUser)
 		mux.Get("/users", app.GetAllUsers)
 		mux.Post("/users", app.CreateUser)
+		mux.Post("/users/import", app.ImportUsers)
+		mux.Get("/users/export", app.ExportUsers)
+		mux.Get("/users/search", app.SearchUsers)
 		mux.Get("/users/{id}", app.GetOneUser)
 		mux.Put("/users/{id}", app.UpdateUser)
+		mux.Patch("/users/{id}", app.PatchUser)
 		mux.Delete("/users/{id}", app.DeleteUser)
+		mux.Post("/users/{id}/unlock", app.UnlockUser)
+		mux.Post("/users/{id}/restore", app.RestoreUser)
+		mux.Put("/users/{id}/status", app.SetUserStatus)
+		mux.Get("/users/{id}/logins", app.GetUserLogins)
+		mux.Get("/invitations", app.GetInvitations)
+		mux.Post("/invitations", app.CreateInvitation)
+		mux.Delete("/invitations/{id}", app.RevokeInvitation)
+		mux.Get("/2fa-policy", app.GetTwoFactorPolicy)
+		mux.Put("/2fa-policy", app.SetTwoFactorPolicy)
+
+	})
+
+	mux.Route("/api/routes", func(mux chi.Router) {
+		mux.Use(app.WithScope([]string{"read:a", "write:a", "read:b", "write:b"}))
+		mux.Get("/", app.GetRoutes)
+	})
+
+	// cross-organization routes
+	mux.Route("/api/organizations", func(mux chi.Router) {
+		mux.Use(app.WithScope([]string{u.SUPER_ADMIN_SCOPE}))
+		mux.Get("/", app.GetAllOrganizations)
+		mux.Post("/", app.CreateOrganization)
+		mux.Post("/{id}/members", app.AddMember)
+	})
 
+	mux.Route("/api/settings", func(mux chi.Router) {
+		mux.Use(app.WithScope([]string{u.SUPER_ADMIN_SCOPE}))
+		mux.Get("/attributes-schema", app.GetAttributesSchema)
+		mux.Put("/attributes-schema", app.SetAttributesSchema)
 	})
 
 	return mux
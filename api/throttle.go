@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	md "nfs002/template/v1/internal/models"
+	ut "nfs002/template/v1/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// accountThrottleKey returns the key failed logins to an account are counted under
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP returns the request's source IP, which is the forwarded client IP when
+// proxy headers are trusted
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+// ipThrottleKey returns the key failed logins from the request's source IP are counted under
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// recordLoginFailure counts a failed login against both the account and the source IP
+func (app *application) recordLoginFailure(r *http.Request, email string) {
+	if _, err := app.DB.RecordLoginFailure(accountThrottleKey(email), app.config.login.account); err != nil {
+		ut.ErrorLog("Error recording failed login for account", err)
+	}
+
+	if _, err := app.DB.RecordLoginFailure(ipThrottleKey(r), app.config.login.ip); err != nil {
+		ut.ErrorLog("Error recording failed login for IP", err)
+	}
+}
+
+// UnlockUser clears the failed logins of a user (by id from the url), unlocking their account
+func (app *application) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(id)
+
+	if userID <= 0 || err != nil {
+		ut.ErrorLog("Error parsing 'id' parameter", err)
+		app.badRequest(w, errors.New("invalid request parameter 'UserID'"))
+		return
+	}
+
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	user, err := app.DB.GetOneUser(userID, orgID, md.UserRepresentation{Fields: []string{"email"}})
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	if err := app.DB.ClearLoginFailures(accountThrottleKey(user.Email)); err != nil {
+		ut.ErrorLog("Error unlocking user", err)
+		app.internalError(w)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "succesfully unlocked user"
+	app.writeJSON(w, http.StatusOK, resp)
+}
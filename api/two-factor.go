@@ -0,0 +1,293 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	md "nfs002/template/v1/internal/models"
+	"nfs002/template/v1/internal/totp"
+	ut "nfs002/template/v1/internal/utils"
+)
+
+// verifyOTP checks a TOTP code, which can only be used once, or an unused recovery code
+func (app *application) verifyOTP(userID int, secret, otp string) (bool, error) {
+	if counter, ok := totp.Validate(secret, otp, time.Now(), 1); ok {
+		return app.DB.UseTOTPCounter(userID, counter)
+	}
+
+	return app.DB.UseRecoveryCode(userID, otp)
+}
+
+// Errors of token requests with a missing or wrong second factor
+var (
+	errOTPRequired = errors.New("one time password required")
+	errInvalidOTP  = errors.New("invalid one time password")
+)
+
+// checkSecondFactor checks the second factor of a token request. Users with two-factor
+// authentication enabled must send a valid otp (errOTPRequired or errInvalidOTP), and
+// users without it cannot request any scope their organization requires two-factor
+// authentication for. Any other error is unexpected
+func (app *application) checkSecondFactor(user md.User, input md.TokenRequest, orgID int) error {
+	if !user.TOTPEnabled {
+		required, err := app.DB.GetRequired2FAScope(orgID)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range input.Scope {
+			if slices.Contains(required, s) {
+				return md.NewError(md.ErrForbidden, "two-factor authentication is required for scope '%s'", s)
+			}
+		}
+		return nil
+	}
+
+	if input.OTP == "" {
+		return errOTPRequired
+	}
+
+	valid, err := app.verifyOTP(user.ID, user.TOTPSecret, input.OTP)
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return errInvalidOTP
+	}
+
+	return nil
+}
+
+// EnrollTOTP generates a new TOTP secret for the caller, which must be confirmed with
+// ConfirmTOTP before two-factor authentication is enabled
+func (app *application) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := contextUser(r)
+	if !ok {
+		app.internalError(w)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.internalError(w)
+		return
+	}
+
+	if err := app.DB.SetTOTPSecret(u.ID, secret); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+		Secret  string `json:"secret"`
+		URI     string `json:"uri"`
+	}
+
+	resp.Error = false
+	resp.Message = "add the secret to an authenticator app, then confirm it with a code"
+	resp.Secret = secret
+	resp.URI = totp.URI(app.config.totpIssuer, u.Email, secret)
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// ConfirmTOTP enables two-factor authentication for the caller with a code from their
+// authenticator app, and returns their recovery codes, which are only ever shown once
+func (app *application) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := contextUser(r)
+	if !ok {
+		app.internalError(w)
+		return
+	}
+
+	var input md.OTPRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	secret, enabled, err := app.DB.GetUserTOTP(u.ID)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	if enabled {
+		app.conflict(w, errors.New("two-factor authentication is already enabled"))
+		return
+	}
+
+	if secret == "" {
+		app.conflict(w, errors.New("two-factor authentication has not been enrolled"))
+		return
+	}
+
+	counter, valid := totp.Validate(secret, input.OTP, time.Now(), 1)
+	if !valid {
+		app.errorResponse(w, md.NewError(md.ErrValidation, "invalid one time password"))
+		return
+	}
+
+	codes, hashes, err := md.GenerateRecoveryCodes(10)
+	if err != nil {
+		app.internalError(w)
+		return
+	}
+
+	if err := app.DB.EnableTOTP(u.ID, counter, hashes); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error         bool     `json:"error"`
+		Message       string   `json:"message"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	resp.Error = false
+	resp.Message = "two-factor authentication enabled, store the recovery codes somewhere safe"
+	resp.RecoveryCodes = codes
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// DisableTOTP disables two-factor authentication for the caller, with a code from their
+// authenticator app or a recovery code
+func (app *application) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := contextUser(r)
+	if !ok {
+		app.internalError(w)
+		return
+	}
+
+	var input md.OTPRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	// guessing codes counts towards the same lockout as logging in
+	wait, err := app.DB.GetLockout(accountThrottleKey(u.Email), ipThrottleKey(r))
+	if err != nil {
+		ut.ErrorLog("Error checking login lockout", err)
+		app.internalError(w)
+		return
+	}
+
+	if wait > 0 {
+		app.tooManyRequests(w, wait)
+		return
+	}
+
+	secret, enabled, err := app.DB.GetUserTOTP(u.ID)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	if !enabled {
+		app.conflict(w, errors.New("two-factor authentication is not enabled"))
+		return
+	}
+
+	valid, err := app.verifyOTP(u.ID, secret, input.OTP)
+	if err != nil {
+		app.internalError(w)
+		return
+	}
+
+	if !valid {
+		app.recordLoginFailure(r, u.Email)
+		app.errorResponse(w, md.NewError(md.ErrValidation, "invalid one time password"))
+		return
+	}
+
+	if err := app.DB.DisableTOTP(u.ID); err != nil {
+		ut.ErrorLog("Error disabling TOTP", err)
+		app.internalError(w)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "two-factor authentication disabled"
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// policyOrganization returns the organization whose two-factor policy a request is for
+func (app *application) policyOrganization(r *http.Request) (int, error) {
+	orgID, err := app.organizationFilter(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if orgID == 0 {
+		return 0, errors.New("query parameter 'organization_id' is required")
+	}
+
+	return orgID, nil
+}
+
+// GetTwoFactorPolicy returns the scopes of the caller's organization which require
+// two-factor authentication
+func (app *application) GetTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	orgID, err := app.policyOrganization(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	scope, err := app.DB.GetRequired2FAScope(orgID)
+	if err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Scope []string `json:"scope"`
+	}
+
+	resp.Scope = scope
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// SetTwoFactorPolicy sets the scopes of the caller's organization which require
+// two-factor authentication
+func (app *application) SetTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	orgID, err := app.policyOrganization(r)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	var input md.TwoFactorPolicyRequest
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	if err := app.DB.SetRequired2FAScope(orgID, input.Scope); err != nil {
+		app.errorResponse(w, err)
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	resp.Error = false
+	resp.Message = "two-factor authentication policy succesfully updated"
+	app.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// FileSender writes each message to an .eml file in a directory, for local development
+type FileSender struct {
+	dir  string
+	from string
+}
+
+func NewFileSender(cfg Config) (*FileSender, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSender{dir: cfg.Dir, from: cfg.From}, nil
+}
+
+func (s *FileSender) Send(msg Message) error {
+	to := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), to)
+
+	return os.WriteFile(filepath.Join(s.dir, name), msg.Bytes(s.from), 0o644)
+}
+
+// LogSender logs each message instead of sending it, for local development
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	log.Info().Str("to", msg.To).Str("subject", msg.Subject).Str("body", msg.Body).Msg("Sending email")
+	return nil
+}
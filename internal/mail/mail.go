@@ -0,0 +1,62 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Message is a plain text email message
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender sends email messages
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Config is the configuration of the mail transport
+type Config struct {
+	Transport string // smtp, file or log
+	From      string
+	Dir       string // directory written to by the file transport
+	SMTP      struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+	}
+}
+
+// NewSender returns the sender for the configured transport
+func NewSender(cfg Config) (Sender, error) {
+	switch cfg.Transport {
+	case "smtp":
+		return NewSMTPSender(cfg), nil
+	case "file":
+		return NewFileSender(cfg)
+	case "log", "":
+		return LogSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport '%s'", cfg.Transport)
+	}
+}
+
+// Bytes formats the message as an RFC 5322 message from the given address
+func (m Message) Bytes(from string) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(m.Body)
+
+	return b.Bytes()
+}
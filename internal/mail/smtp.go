@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+)
+
+// SMTPSender sends messages through an SMTP server
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPSender(cfg Config) *SMTPSender {
+	s := &SMTPSender{
+		addr: fmt.Sprintf("%s:%d", cfg.SMTP.Host, cfg.SMTP.Port),
+		from: cfg.From,
+	}
+
+	if cfg.SMTP.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+
+	return s
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, msg.Bytes(s.from))
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Attributes are the custom profile attributes of a user (e.g department, locale),
+// stored as JSONB and validated against the user attributes schema
+type Attributes map[string]any
+
+// Scan implements sql.Scanner for JSONB columns
+func (a *Attributes) Scan(src any) error {
+	var data []byte
+
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Attributes", src)
+	}
+
+	return json.Unmarshal(data, a)
+}
+
+// Value implements driver.Valuer, storing nil attributes as NULL
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	out, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(out), nil
+}
+
+// GetAttributesSchema gets the JSON schema user attributes are validated against
+func (m *DBModel) GetAttributesSchema() (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var schema []byte
+
+	query := `select value from settings where key = 'user_attributes_schema'`
+
+	if err := m.DB.QueryRowContext(ctx, query).Scan(&schema); err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(schema), nil
+}
+
+// SetAttributesSchema sets the JSON schema user attributes are validated against. Existing
+// attributes are not validated against the new schema until they are next written
+func (m *DBModel) SetAttributesSchema(schema json.RawMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if !json.Valid(schema) {
+		return NewError(ErrValidation, "schema is not valid JSON")
+	}
+
+	stmt := `
+		insert into settings (key, value) values ('user_attributes_schema', $1)
+		on conflict (key) do update set value = excluded.value`
+
+	_, err := m.DB.ExecContext(ctx, stmt, string(schema))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ExistingEmails returns which of the email addresses already belong to a user
+func (m *DBModel) ExistingEmails(emails []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	normalized := make([]string, 0, len(emails))
+	for _, e := range emails {
+		normalized = append(normalized, normalizeEmail(e))
+	}
+
+	query := `select lower(email) from users where lower(email) = any($1) and deleted_at is null`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(normalized))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		existing = append(existing, email)
+	}
+
+	return existing, rows.Err()
+}
+
+// ImportUsers inserts verified users as members of the given organization in a single
+// transaction, so either every user is imported or none are, and returns their ids.
+// hashes holds the password hash of each user, which is empty for users without a
+// usable password
+func (m *DBModel) ImportUsers(users []ImportUserRequest, hashes []string, orgID int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int, 0, len(users))
+	for i, u := range users {
+		id, err := insertUser(ctx, tx, CreateUserRequest(u), hashes[i], orgID, true)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, tx.Commit()
+}
+
+// ExportUsers gets every user of an organization, or of every organization if orgID is 0,
+// ordered by id. Scope is the user's scope within the organization, and is left empty
+// when exporting every organization
+func (m *DBModel) ExportUsers(orgID int) ([]ExportedUser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	query := `
+		select
+			u.id, u.first_name, u.last_name, u.email, coalesce(m.scope, ''), u.status, u.attributes, u.created_at
+		from
+			users u
+			left join memberships m on (m.user_id = u.id and m.organization_id = $1)
+		where
+			u.deleted_at is null and ($1 = 0 or m.id is not null)
+		order by
+			u.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []ExportedUser{}
+	for rows.Next() {
+		var u ExportedUser
+		var scope string
+		err = rows.Scan(
+			&u.ID,
+			&u.FirstName,
+			&u.LastName,
+			&u.Email,
+			&scope,
+			&u.Status,
+			&u.Attributes,
+			&u.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		u.Scope = []string{}
+		if scope != "" {
+			u.Scope = strings.Split(scope, ",")
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors returned by DBModel methods, checked with errors.Is. Any other error
+// is unexpected, such as the database being unavailable
+var (
+	// ErrNotFound is the kind of error for a resource that does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is the kind of error for a write conflicting with the current state
+	ErrConflict = errors.New("conflict")
+	// ErrValidation is the kind of error for a well formed request that cannot be processed
+	ErrValidation = errors.New("validation failed")
+	// ErrForbidden is the kind of error for a request the caller is not allowed to make
+	ErrForbidden = errors.New("forbidden")
+	// ErrPrecondition is the kind of error for a conditional write whose condition fails
+	ErrPrecondition = errors.New("precondition failed")
+)
+
+// Error is an error of a kind, with a message that is safe to show to clients
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// NewError returns an error of kind with a formatted message
+func NewError(kind error, format string, args ...any) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
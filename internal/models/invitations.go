@@ -0,0 +1,300 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Statuses of an invitation
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// ErrInvitationNotFound is returned for invite tokens that do not belong to any invitation
+var ErrInvitationNotFound error = &Error{Kind: ErrNotFound, Message: "invalid invitation token"}
+
+// Invitation is the type for an admin's invitation of a new user to an organization
+// with a preassigned scope. Like other tokens, only the hash of the invite token is
+// persisted
+type Invitation struct {
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organization_id"`
+	InvitedBy      *int       `json:"invited_by"`
+	Email          string     `json:"email"`
+	FirstName      string     `json:"first_name"`
+	LastName       string     `json:"last_name"`
+	Scope          []string   `json:"scope"`
+	Status         string     `json:"status"`
+	Expiry         time.Time  `json:"expiry"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	PlainText      string     `json:"-"`
+	Hash           string     `json:"-"`
+}
+
+// GenerateInvitation generates a pending invitation with a new invite token that lasts for ttl
+func GenerateInvitation(orgID, invitedBy int, u CreateInvitationRequest, ttl time.Duration) (*Invitation, error) {
+	plainText, hash, err := newTokenString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Invitation{
+		OrganizationID: orgID,
+		InvitedBy:      &invitedBy,
+		Email:          normalizeEmail(u.Email),
+		FirstName:      strings.TrimSpace(u.FirstName),
+		LastName:       strings.TrimSpace(u.LastName),
+		Scope:          u.Scope,
+		Status:         InvitationPending,
+		Expiry:         time.Now().Add(ttl),
+		PlainText:      plainText,
+		Hash:           hash,
+	}, nil
+}
+
+// status derives the status of an invitation from its timestamps
+func (inv *Invitation) status() string {
+	switch {
+	case inv.AcceptedAt != nil:
+		return InvitationAccepted
+	case inv.RevokedAt != nil:
+		return InvitationRevoked
+	case time.Now().After(inv.Expiry):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+// Columns of an invitation, in the order scanInvitation expects
+const invitationColumns = `
+	id, organization_id, invited_by, email, first_name, last_name, scope, expiry, accepted_at, revoked_at, created_at`
+
+// scanInvitation scans a row of invitationColumns
+func scanInvitation(row interface{ Scan(...any) error }) (*Invitation, error) {
+	var inv Invitation
+	var scope string
+
+	err := row.Scan(
+		&inv.ID,
+		&inv.OrganizationID,
+		&inv.InvitedBy,
+		&inv.Email,
+		&inv.FirstName,
+		&inv.LastName,
+		&scope,
+		&inv.Expiry,
+		&inv.AcceptedAt,
+		&inv.RevokedAt,
+		&inv.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	inv.Expiry = localTime(inv.Expiry)
+	inv.Scope = []string{}
+	if scope != "" {
+		inv.Scope = strings.Split(scope, ",")
+	}
+	inv.Status = inv.status()
+
+	return &inv, nil
+}
+
+// InsertInvitation saves an invitation, revoking any other pending invitation of the
+// same email address to the organization, and sends it with send. Nothing is saved
+// unless the invitation is sent. Email addresses already belonging to a user can't be
+// invited
+func (m *DBModel) InsertInvitation(inv *Invitation, send func(*Invitation) error) error {
+	// sending the invitation can take longer than a query
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	query := `select exists (select 1 from users where lower(email) = $1 and deleted_at is null)`
+	if err := tx.QueryRowContext(ctx, query, inv.Email).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrDuplicateEmail
+	}
+
+	stmt := `
+		update invitations set revoked_at = now()
+		where organization_id = $1 and lower(email) = $2 and accepted_at is null and revoked_at is null`
+
+	if _, err := tx.ExecContext(ctx, stmt, inv.OrganizationID, inv.Email); err != nil {
+		return err
+	}
+
+	stmt = `
+		insert into invitations
+			(organization_id, invited_by, email, first_name, last_name, scope, token_hash, expiry)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		returning id, created_at`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		inv.OrganizationID,
+		inv.InvitedBy,
+		inv.Email,
+		inv.FirstName,
+		inv.LastName,
+		strings.Join(inv.Scope, ","),
+		inv.Hash,
+		inv.Expiry).Scan(&inv.ID, &inv.CreatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	if err := send(inv); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetInvitations gets the invitations of an organization, or of every organization if
+// orgID is 0, newest first
+func (m *DBModel) GetInvitations(orgID int) ([]*Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + invitationColumns + `
+		from invitations
+		where ($1 = 0 or organization_id = $1)
+		order by id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// GetInvitationByToken gets a pending invitation by its plain text invite token
+func (m *DBModel) GetInvitationByToken(plainText string) (*Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + invitationColumns + ` from invitations where token_hash = $1`
+
+	inv, err := scanInvitation(m.DB.QueryRowContext(ctx, query, hashToken(plainText)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if inv.Status != InvitationPending {
+		return nil, NewError(ErrConflict, "invitation is %s", inv.Status)
+	}
+
+	return inv, nil
+}
+
+// RevokeInvitation revokes a pending invitation of an organization, or of any
+// organization if orgID is 0
+func (m *DBModel) RevokeInvitation(id, orgID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		update invitations set revoked_at = now()
+		where id = $1 and ($2 = 0 or organization_id = $2) and accepted_at is null and revoked_at is null`
+
+	res, err := m.DB.ExecContext(ctx, stmt, id, orgID)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return NewError(ErrNotFound, "no pending invitation found")
+	}
+
+	return nil
+}
+
+// AcceptInvitation creates the invited user, with a verified email address, as a
+// member of the invitation's organization with its scope, and marks the invitation
+// as accepted. Names default to those given in the invitation
+func (m *DBModel) AcceptInvitation(u AcceptInvitationRequest, hash string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// lock the invitation so it can only be accepted once
+	query := `select ` + invitationColumns + ` from invitations where token_hash = $1 for update`
+
+	inv, err := scanInvitation(tx.QueryRowContext(ctx, query, hashToken(u.Token)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvitationNotFound
+	} else if err != nil {
+		return 0, err
+	}
+
+	if inv.Status != InvitationPending {
+		return 0, NewError(ErrConflict, "invitation is %s", inv.Status)
+	}
+
+	user := CreateUserRequest{
+		FirstName: strings.TrimSpace(u.FirstName),
+		LastName:  strings.TrimSpace(u.LastName),
+		Email:     inv.Email,
+		Scope:     inv.Scope,
+	}
+
+	if user.FirstName == "" {
+		user.FirstName = inv.FirstName
+	}
+	if user.LastName == "" {
+		user.LastName = inv.LastName
+	}
+
+	if user.FirstName == "" || user.LastName == "" {
+		return 0, NewError(ErrValidation, "first_name and last_name are required")
+	}
+
+	userID, err := insertUser(ctx, tx, user, hash, inv.OrganizationID, true)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `update invitations set accepted_at = now() where id = $1`, inv.ID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Reasons a token request failed
+const (
+	LoginInvalidRequest  = "invalid_request"
+	LoginLockedOut       = "locked_out"
+	LoginUnknownEmail    = "unknown_email"
+	LoginWrongPassword   = "wrong_password"
+	LoginEmailUnverified = "email_unverified"
+	LoginInactive        = "inactive"
+	LoginNoMembership    = "no_membership"
+	LoginScopeDenied     = "scope_denied"
+	LoginSecondFactor    = "second_factor"
+	LoginError           = "error"
+)
+
+// LoginEvent is the type for a recorded token request. UserID is nil when the email
+// address didn't belong to a user
+type LoginEvent struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user_id"`
+	Email     string    `json:"email"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsertLoginEvent records a token request
+func (m *DBModel) InsertLoginEvent(e LoginEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into login_events (user_id, email, success, reason, ip, user_agent)
+		values ($1, $2, $3, $4, $5, $6)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, e.UserID, normalizeEmail(e.Email), e.Success, e.Reason, e.IP, e.UserAgent)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetLoginEvents gets a page of the token requests of a user, newest first, positioned
+// with the cursor of the previous page
+func (m *DBModel) GetLoginEvents(userID int, q ListLoginsRequest) (LoginPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	page := LoginPage{Logins: []*LoginEvent{}}
+
+	before := 0
+	if q.Cursor != "" {
+		c, err := DecodeCursor(q.Cursor)
+		if err != nil || len(c.Values) != 0 {
+			return page, ErrInvalidCursor
+		}
+		before = c.ID
+	}
+
+	// fetch one extra row to know whether there is a next page
+	query := `
+		select
+			id, user_id, email, success, reason, ip, user_agent, created_at
+		from
+			login_events
+		where user_id = $1 and ($2 = 0 or id < $2)
+		order by
+			id desc
+		limit $3`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, before, q.Limit+1)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e LoginEvent
+		err = rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.Email,
+			&e.Success,
+			&e.Reason,
+			&e.IP,
+			&e.UserAgent,
+			&e.CreatedAt)
+
+		if err != nil {
+			return page, err
+		}
+		page.Logins = append(page.Logins, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Logins) > q.Limit {
+		page.Logins = page.Logins[:q.Limit]
+		page.NextCursor = Cursor{Values: []string{}, ID: page.Logins[q.Limit-1].ID}.Encode()
+	}
+
+	return page, nil
+}
@@ -9,7 +9,9 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"nfs002/template/v1/internal/utils"
+
+	"github.com/lib/pq"
 )
 
 // DBModel is the type for database connection values
@@ -31,6 +33,46 @@ func NewModels(db *sql.DB) Models {
 	}
 }
 
+// ErrDuplicateEmail is returned when writing a user whose email address already belongs
+// to another user, ignoring case
+var ErrDuplicateEmail error = &Error{Kind: ErrConflict, Message: "a user with this email address already exists"}
+
+// ErrUserNotFound is returned for users that do not exist, or not in the organization
+var ErrUserNotFound error = &Error{Kind: ErrNotFound, Message: "user not found"}
+
+// ErrSharedUser is returned when an admin of one organization changes the account of a
+// user who is also a member of other organizations
+var ErrSharedUser error = &Error{Kind: ErrForbidden, Message: "user is also a member of other organizations, only a super-admin can change their account"}
+
+// ErrGlobalUser is returned when an admin of one organization changes the account of a
+// user with a global scope, such as a super-admin
+var ErrGlobalUser error = &Error{Kind: ErrForbidden, Message: "user has a global scope, only a super-admin can change their account"}
+
+// ErrPreconditionFailed is returned when writing a user whose version no
+// longer matches the version the write was based on
+var ErrPreconditionFailed error = &Error{Kind: ErrPrecondition, Message: "user has been modified since it was read"}
+
+// normalizeEmail returns the form email addresses are stored and looked up in
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// uniqueViolation maps violations of the unique email index to ErrDuplicateEmail
+func uniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_unique_idx" {
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+// Statuses of a user account. Only active users can authenticate
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusDisabled  = "disabled"
+)
+
 // User is the type for all users
 type User struct {
 	ID        int       `json:"id"`
@@ -41,33 +83,60 @@ type User struct {
 	Scope     string    `json:"scope"`
 	CreatedAt time.Time `json:"-"`
 	UpdatedAt time.Time `json:"-"`
+
+	// nil until the user verifies their email address
+	EmailVerifiedAt *time.Time `json:"-"`
+
+	Status       string `json:"status"`
+	StatusReason string `json:"status_reason"`
+
+	// TOTP two-factor authentication
+	TOTPSecret      string `json:"-"`
+	TOTPEnabled     bool   `json:"-"`
+	TOTPLastCounter int64  `json:"-"`
 }
 
-func (u User) CanRequestScope(requestedScope []string) error {
+// CanRequestScope checks the requested scope is held by the user, either globally
+// or within the organization of the given membership. The super-admin scope can
+// only be held globally
+func (u User) CanRequestScope(requestedScope []string, ms Membership) error {
 	userScope := strings.Split(u.Scope, ",")
+	orgScope := strings.Split(ms.Scope, ",")
 	for _, rs := range requestedScope {
-		if !slices.Contains(userScope, rs) {
-			return fmt.Errorf("requested scope '%s' is invalid for user", rs)
+		if slices.Contains(userScope, rs) {
+			continue
 		}
+		if rs != utils.SUPER_ADMIN_SCOPE && slices.Contains(orgScope, rs) {
+			continue
+		}
+		return NewError(ErrForbidden, "requested scope '%s' is invalid for user", rs)
 	}
 	return nil
 }
 
+// inOrganization restricts a users query to members of the organization given by
+// the placeholder, or to no organization at all if its value is 0
+func inOrganization(placeholder string) string {
+	return fmt.Sprintf(`(%[1]s = 0 or exists (
+		select 1 from memberships m where m.user_id = users.id and m.organization_id = %[1]s))`, placeholder)
+}
+
 // GetUserByEmail gets a user by email address
 func (m *DBModel) GetUserByEmail(email string) (User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	email = strings.ToLower(email)
+	email = normalizeEmail(email)
 
 	var u User
 
 	stmt := `
 		select
-		    id, first_name, last_name, email, password, scope, created_at, updated_at 
+		    id, first_name, last_name, email, password, scope, created_at, updated_at, email_verified_at,
+		    status, status_reason, totp_secret, totp_enabled, totp_last_counter
 		from 
 			users
-		where email = $1
+		where lower(email) = $1 and deleted_at is null
 	`
 
 	row := m.DB.QueryRowContext(ctx, stmt, email)
@@ -82,120 +151,298 @@ func (m *DBModel) GetUserByEmail(email string) (User, error) {
 		&u.Scope,
 		&u.CreatedAt,
 		&u.UpdatedAt,
+		&u.EmailVerifiedAt,
+		&u.Status,
+		&u.StatusReason,
+		&u.TOTPSecret,
+		&u.TOTPEnabled,
+		&u.TOTPLastCounter,
 	)
 
-	if err != nil {
-		return u, errors.New("invalid credentials")
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrUserNotFound
+	} else if err != nil {
+		return u, err
 	}
 
 	return u, nil
 }
 
-func (m *DBModel) Authenticate(email, password string) (int, error) {
+// UpdatePasswordForUser replaces the password hash of a user
+func (m *DBModel) UpdatePasswordForUser(userId int, hash string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	email = strings.ToLower(email)
+	stmt := `update users set password = $1 where id = $2 and deleted_at is null`
 
-	var id int
-	var hashedPassword string
-
-	row := m.DB.QueryRowContext(ctx, "select id, password from users where email = ?", email)
-	err := row.Scan(&id, &hashedPassword)
+	_, err := m.DB.ExecContext(ctx, stmt, hash, userId)
 	if err != nil {
-		return id, err
+		return err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return 0, errors.New("incorrect password")
-	} else if err != nil {
-		return 0, err
-	} else {
-		return id, nil
+	return nil
+}
+
+// Columns users can be sorted by, for each sort field
+var userSortColumns = map[string][]string{
+	"name":       {"last_name", "first_name"},
+	"email":      {"email"},
+	"created_at": {"created_at"},
+}
+
+// userCursor returns the cursor positioned at a user for the given sort field
+func userCursor(sort string, id int, u *GetUserResponse) Cursor {
+	switch sort {
+	case "email":
+		return Cursor{Values: []string{u.Email}, ID: id}
+	case "created_at":
+		return Cursor{Values: []string{u.CreatedAt.Format(time.RFC3339Nano)}, ID: id}
+	default:
+		return Cursor{Values: []string{u.LastName, u.FirstName}, ID: id}
 	}
 }
 
-func (m *DBModel) UpdatePasswordForUser(userId int, u UpdateUserRequest, hash string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// userFilters returns the conditions restricting a users query to an organization
+// (unless orgID is 0) and to the filters of the request
+func userFilters(orgID int, q ListUsersRequest, args *queryArgs) []string {
+	org := args.add(orgID)
+	where := []string{"deleted_at is null", inOrganization(org)}
 
-	stmt := `update users set password = $1 where id = $2`
+	if q.Email != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q.Email)
+		where = append(where, fmt.Sprintf(`email ilike '%%' || %s::text || '%%'`, args.add(escaped)))
+	}
 
-	_, err := m.DB.ExecContext(ctx, stmt, hash, userId)
-	if err != nil {
-		return err
+	if q.Scope != "" {
+		scope := args.add(q.Scope)
+		where = append(where, fmt.Sprintf(`(%[2]s = any(string_to_array(users.scope, ',')) or exists (
+			select 1 from memberships m where m.user_id = users.id
+			and (%[1]s = 0 or m.organization_id = %[1]s)
+			and %[2]s = any(string_to_array(m.scope, ','))))`, org, scope))
 	}
 
-	return nil
+	if q.CreatedAfter != nil {
+		where = append(where, "created_at >= "+args.add(*q.CreatedAfter))
+	}
+
+	if q.CreatedBefore != nil {
+		where = append(where, "created_at < "+args.add(*q.CreatedBefore))
+	}
+
+	// sorted so the same filters always build the same query
+	names := make([]string, 0, len(q.Attributes))
+	for name := range q.Attributes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		where = append(where, fmt.Sprintf("attributes ->> %s = %s::text", args.add(name), args.add(q.Attributes[name])))
+	}
+
+	return where
 }
 
-func (m *DBModel) GetAllUsers() ([]*GetUserResponse, error) {
+// GetAllUsers gets a page of the users of an organization, or of every organization if
+// orgID is 0, matching the filters of the request. Pages are positioned with a cursor
+// on the sort columns rather than an offset, so they stay stable while users change
+func (m *DBModel) GetAllUsers(orgID int, q ListUsersRequest) (UserPage, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var users []*GetUserResponse
+	page := UserPage{Users: []*GetUserResponse{}}
 
-	query := `
+	columns, ok := userSortColumns[q.Sort]
+	if !ok {
+		return page, NewError(ErrValidation, "invalid sort field '%s'", q.Sort)
+	}
+
+	// count every matching user, regardless of the page
+	args := queryArgs{}
+	where := userFilters(orgID, q, &args)
+
+	count := `select count(*) from users where ` + strings.Join(where, " and ")
+	if err := m.DB.QueryRowContext(ctx, count, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	dir, op := "asc", ">"
+	if q.Order == "desc" {
+		dir, op = "desc", "<"
+	}
+
+	if q.Cursor != "" {
+		c, err := DecodeCursor(q.Cursor)
+		if err != nil || len(c.Values) != len(columns) {
+			return page, ErrInvalidCursor
+		}
+
+		var placeholders []string
+		for i, v := range c.Values {
+			p := args.add(v)
+			if columns[i] == "created_at" {
+				p += "::timestamp"
+			}
+			placeholders = append(placeholders, p)
+		}
+		placeholders = append(placeholders, args.add(c.ID))
+
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s)",
+			strings.Join(columns, ", "), op, strings.Join(placeholders, ", ")))
+	}
+
+	var order []string
+	for _, c := range append(columns, "id") {
+		order = append(order, c+" "+dir)
+	}
+
+	// only select the requested fields, and those needed for the cursor. userFilters
+	// adds the organization as the first argument
+	selected, dests := userColumns(q.fields(), append([]string{"id"}, userSortFields[q.Sort]...), "$1")
+
+	// fetch one extra row to know whether there is a next page
+	query := fmt.Sprintf(`
 		select
-			first_name, last_name, email, created_at
+			%s
 		from
 			users
+		where %s
 		order by
-			last_name, first_name
-	`
+			%s
+		limit %s
+	`, strings.Join(selected, ", "), strings.Join(where, " and "), strings.Join(order, ", "), args.add(q.Limit+1))
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return page, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var u GetUserResponse
-		err = rows.Scan(
-			&u.FirstName,
-			&u.LastName,
-			&u.Email,
-			&u.CreatedAt)
+		u := GetUserResponse{fields: q.output()}
+		if err := rows.Scan(dests(&u)...); err != nil {
+			return page, err
+		}
+		page.Users = append(page.Users, &u)
+	}
 
-		if err != nil {
-			return nil, err
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Users) > q.Limit {
+		page.Users = page.Users[:q.Limit]
+		last := page.Users[q.Limit-1]
+		page.NextCursor = userCursor(q.Sort, last.ID, last).Encode()
+	}
+
+	if slices.Contains(q.Include, "tokens") && len(page.Users) > 0 {
+		if err := m.includeTokens(page.Users, orgID); err != nil {
+			return page, err
 		}
-		users = append(users, &u)
 	}
 
-	return users, nil
+	return page, nil
 }
 
-func (m *DBModel) GetOneUser(id int) (GetUserResponse, error) {
+// GetOneUser gets a user of an organization, or of any organization if orgID is 0,
+// with the requested fields and embeds
+func (m *DBModel) GetOneUser(id, orgID int, rep UserRepresentation) (GetUserResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var u GetUserResponse
+	u := GetUserResponse{fields: rep.output()}
+
+	// the version is always needed for the ETag
+	selected, dests := userColumns(rep.fields(), []string{"id", "version"}, "$2")
 
 	query := `
 		select
-			first_name, last_name, email, created_at
+			` + strings.Join(selected, ", ") + `
 		from
 			users
-		where id = $1`
-
-	row := m.DB.QueryRowContext(ctx, query, id)
+		where id = $1 and deleted_at is null and ` + inOrganization("$2")
 
-	err := row.Scan(
-		&u.FirstName,
-		&u.LastName,
-		&u.Email,
-		&u.CreatedAt)
+	row := m.DB.QueryRowContext(ctx, query, id, orgID)
 
-	if err != nil {
+	if err := row.Scan(dests(&u)...); errors.Is(err, sql.ErrNoRows) {
+		return u, ErrUserNotFound
+	} else if err != nil {
 		return u, err
 	}
+
+	if slices.Contains(rep.Include, "tokens") {
+		if err := m.includeTokens([]*GetUserResponse{&u}, orgID); err != nil {
+			return u, err
+		}
+	}
+
 	return u, nil
 }
 
-func (m *DBModel) EditUser(userId int, u UpdateUserRequest) error {
+// sharedUser reports whether a user of organization orgID is also a member of others. The
+// user's account is shared by all of them, so only a super-admin (orgID 0) may change it.
+// Users with a global scope are never changed within an organization, and ErrGlobalUser
+// is returned for them
+func sharedUser(ctx context.Context, q queryRower, userID, orgID int) (bool, error) {
+	if orgID == 0 {
+		return false, nil
+	}
+
+	var member, other, global bool
+
+	query := `
+		select
+			exists (select 1 from memberships where user_id = $1 and organization_id = $2),
+			exists (select 1 from memberships where user_id = $1 and organization_id <> $2),
+			exists (select 1 from users where id = $1 and scope <> '')`
+
+	if err := q.QueryRowContext(ctx, query, userID, orgID).Scan(&member, &other, &global); err != nil {
+		return false, err
+	}
+
+	// users who are not members are left to the write itself, which finds no such user
+	if !member {
+		return false, nil
+	}
+
+	if global {
+		return false, ErrGlobalUser
+	}
+
+	return other, nil
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// userMissingOrChanged explains why a write matching a user's version affected no rows:
+// either there is no such user, or the user has been modified since that version
+func (m *DBModel) userMissingOrChanged(ctx context.Context, q queryRower, id, orgID int) error {
+	var exists bool
+
+	query := `select exists (select 1 from users where id = $1 and deleted_at is null and ` + inOrganization("$2") + `)`
+
+	if err := q.QueryRowContext(ctx, query, id, orgID).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrPreconditionFailed
+	}
+	return ErrUserNotFound
+}
+
+// EditUser updates a user of an organization, or of any organization if orgID is 0. If
+// version is not nil, the user is only updated if their version still equals it
+func (m *DBModel) EditUser(userId, orgID int, u UpdateUserRequest, version *int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -203,66 +450,358 @@ func (m *DBModel) EditUser(userId int, u UpdateUserRequest) error {
 	stmt := `UPDATE users 
 		SET first_name = COALESCE(NULLIF($1, ''), first_name),
 		last_name = COALESCE(NULLIF($2, ''), last_name),
-		email = COALESCE(NULLIF($3, ''), email)
-		WHERE id = $4`
+		email = COALESCE(NULLIF($3, ''), email),
+		attributes = COALESCE($6::jsonb, attributes),
+		version = version + 1
+		WHERE id = $4 AND deleted_at IS NULL AND ($7::int IS NULL OR version = $7)
+		AND ` + inOrganization("$5")
 
 	res, err := m.DB.ExecContext(ctx, stmt,
 		u.FirstName,
 		u.LastName,
-		u.Email,
-		userId)
+		normalizeEmail(u.Email),
+		userId,
+		orgID,
+		u.Attributes,
+		version)
+
+	if err != nil {
+		return uniqueViolation(err)
+	}
 
 	if rows, _ := res.RowsAffected(); rows == 0 {
-		return errors.New("user not found")
+		return m.userMissingOrChanged(ctx, m.DB, userId, orgID)
 	}
 
+	return nil
+}
+
+// ReplaceUser replaces the name, email address and attributes of a user of an organization,
+// or of any organization if orgID is 0, their password unless hash is empty, and their scope
+// within the organization unless u.Scope is nil, in a single transaction. If version is not
+// nil, the user is only replaced if their version still equals it. Users who are also
+// members of other organizations, or have a global scope, can only be changed by a super-admin
+func (m *DBModel) ReplaceUser(userID, orgID int, u ReplaceUserRequest, hash string, version *int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	shared, err := sharedUser(ctx, tx, userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	// replacing a shared user with the same values is still allowed, so that their scope
+	// within the organization can be changed
+	if shared {
+		var changed bool
+
+		query := `
+			select first_name <> $2 or last_name <> $3 or lower(email) <> $4
+				or attributes <> coalesce($5::jsonb, '{}')
+			from users
+			where id = $1 and deleted_at is null`
+
+		err := tx.QueryRowContext(ctx, query, userID, u.FirstName, u.LastName, normalizeEmail(u.Email), u.Attributes).Scan(&changed)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if changed || hash != "" {
+			return ErrSharedUser
+		}
+	}
+
+	stmt := `
+		update users
+		set first_name = $1, last_name = $2, email = $3, attributes = coalesce($4::jsonb, '{}'),
+			password = coalesce(nullif($8, ''), password), version = version + 1
+		where id = $5 and deleted_at is null and ($7::int is null or version = $7)
+		and ` + inOrganization("$6")
+
+	res, err := tx.ExecContext(ctx, stmt,
+		u.FirstName,
+		u.LastName,
+		normalizeEmail(u.Email),
+		u.Attributes,
+		userID,
+		orgID,
+		version,
+		hash)
+
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return m.userMissingOrChanged(ctx, tx, userID, orgID)
+	}
+
+	if u.Scope != nil {
+		if err := updateMembershipScope(ctx, tx, userID, orgID, strings.Join(u.Scope, ",")); err != nil {
+			return err
+		}
+
+		// existing tokens keep their scope unless asked to revoke or narrow them
+		if u.Tokens == "revoke" || u.Tokens == "narrow" {
+			if err := restrictTokens(ctx, tx, userID, orgID, u.Scope, u.Tokens == "revoke"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (m *DBModel) AddUser(u User, hash string) error {
+// AddUser inserts a new, verified user as a member of the given organization
+func (m *DBModel) AddUser(u CreateUserRequest, hash string, orgID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	scope := "read:a,write:a,read:b,write:b"
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := insertUser(ctx, tx, u, hash, orgID, true); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RegisterUser inserts a new user with an unverified email address as a member of the
+// given organization, with an email verification token lasting ttl, and sends the token
+// with send. Nothing is saved unless the token is sent, so the user can register again
+func (m *DBModel) RegisterUser(u CreateUserRequest, hash string, orgID int, ttl time.Duration, send func(*OneTimeToken) error) error {
+	// sending the token can take longer than a query
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := insertUser(ctx, tx, u, hash, orgID, false)
+	if err != nil {
+		return err
+	}
+
+	token, err := GenerateOneTimeToken(userID, PurposeVerifyEmail, ttl)
+	if err != nil {
+		return err
+	}
+
+	if err := insertOneTimeToken(ctx, tx, token); err != nil {
+		return err
+	}
+
+	if err := send(token); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertUser inserts a user, and their membership of an organization, within a transaction
+func insertUser(ctx context.Context, tx *sql.Tx, u CreateUserRequest, hash string, orgID int, verified bool) (int, error) {
+	var userID int
 	stmt := `
-		insert into users (first_name, last_name, email, password, scope)
-		values ($1, $2, $3, $4, $5)`
+		insert into users (first_name, last_name, email, password, scope, email_verified_at, attributes)
+		values ($1, $2, $3, $4, '', case when $5 then now() end, coalesce($6::jsonb, '{}'))
+		returning id`
 
-	_, err := m.DB.ExecContext(ctx, stmt,
+	err := tx.QueryRowContext(ctx, stmt,
 		u.FirstName,
 		u.LastName,
-		u.Email,
+		normalizeEmail(u.Email),
 		hash,
-		scope)
+		verified,
+		u.Attributes).Scan(&userID)
 
+	if err != nil {
+		return 0, uniqueViolation(err)
+	}
+
+	stmt = `
+		insert into memberships (organization_id, user_id, scope)
+		values ($1, $2, $3)`
+
+	if _, err = tx.ExecContext(ctx, stmt, orgID, userID, strings.Join(u.Scope, ",")); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// VerifyEmail marks a user's email address as verified
+func (m *DBModel) VerifyEmail(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update users set email_verified_at = coalesce(email_verified_at, now()) where id = $1 and deleted_at is null`
+
+	res, err := m.DB.ExecContext(ctx, stmt, userID)
 	if err != nil {
 		return err
 	}
 
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrUserNotFound
+	}
+
 	return nil
 }
 
-func (m *DBModel) DeleteUser(id int) error {
+// DeleteUser soft deletes a user of an organization, or of any organization if orgID
+// is 0, and deletes all of the user's tokens. The user can be restored with RestoreUser
+// until they are purged by PurgeDeletedUsers. Users who are also members of other
+// organizations are only removed from orgID, with their tokens for it, and removed is
+// true. Users with a global scope can only be deleted by a super-admin. If version is
+// not nil, the user is only deleted if their version still equals it
+func (m *DBModel) DeleteUser(id, orgID int, version *int) (removed bool, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// foreign key constraint (on delete cascade) will also
-	// delete any associated tokens with the user
-	stmt := `delete from users where id = $1`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	shared, err := sharedUser(ctx, tx, id, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	if shared {
+		stmt := `
+			delete from memberships
+			where user_id = $1 and organization_id = $2 and exists (
+				select 1 from users where id = $1 and deleted_at is null
+				and ($3::int is null or version = $3))`
+
+		res, err := tx.ExecContext(ctx, stmt, id, orgID, version)
+		if err != nil {
+			return false, err
+		}
+
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return false, m.userMissingOrChanged(ctx, tx, id, orgID)
+		}
+
+		if _, err := tx.ExecContext(ctx, `delete from tokens where user_id = $1 and organization_id = $2`, id, orgID); err != nil {
+			return false, err
+		}
+
+		return true, tx.Commit()
+	}
 
-	res, err := m.DB.ExecContext(ctx, stmt, id)
+	stmt := `
+		update users set deleted_at = now()
+		where id = $1 and deleted_at is null and ($3::int is null or version = $3)
+		and ` + inOrganization("$2")
+
+	res, err := tx.ExecContext(ctx, stmt, id, orgID, version)
+	if err != nil {
+		return false, err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return false, m.userMissingOrChanged(ctx, tx, id, orgID)
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from tokens where user_id = $1`, id); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from one_time_tokens where user_id = $1`, id); err != nil {
+		return false, err
+	}
+
+	return false, tx.Commit()
+}
+
+// SetUserStatus changes the status of a user of an organization, or of any organization
+// if orgID is 0, recording the reason for the change. The status applies in every
+// organization, so users who are also members of others, or have a global scope, can only
+// be changed by a super-admin
+func (m *DBModel) SetUserStatus(id, orgID int, status, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if shared, err := sharedUser(ctx, tx, id, orgID); err != nil {
+		return err
+	} else if shared {
+		return ErrSharedUser
+	}
+
+	stmt := `
+		update users
+		set status = $1, status_reason = $2, status_changed_at = now(), version = version + 1
+		where id = $3 and deleted_at is null and ` + inOrganization("$4")
+
+	res, err := tx.ExecContext(ctx, stmt, status, reason, id, orgID)
 	if err != nil {
 		return err
 	}
 
 	if rows, _ := res.RowsAffected(); rows == 0 {
-		return errors.New("user not found")
+		return ErrUserNotFound
+	}
+
+	return tx.Commit()
+}
+
+// RestoreUser restores a soft deleted user of an organization, or of any organization if orgID is 0
+func (m *DBModel) RestoreUser(id, orgID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update users set deleted_at = null where id = $1 and deleted_at is not null and ` + inOrganization("$2")
+
+	res, err := m.DB.ExecContext(ctx, stmt, id, orgID)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return NewError(ErrNotFound, "deleted user not found")
 	}
 
 	return nil
+}
+
+// PurgeDeletedUsers permanently deletes users soft deleted longer than retention ago,
+// and returns the number of users purged
+func (m *DBModel) PurgeDeletedUsers(retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// foreign key constraint (on delete cascade) will also
+	// delete any associated tokens and memberships with the user
+	stmt := `delete from users where deleted_at < now() - $1::float8 * interval '1 second'`
+
+	res, err := m.DB.ExecContext(ctx, stmt, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
 
+	return res.RowsAffected()
 }
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"nfs002/template/v1/internal/db"
+)
+
+// testModel connects to the migrated database at $POSTGRESQL_URL, skipping the test
+// when it is not set
+func testModel(t *testing.T) *DBModel {
+	t.Helper()
+
+	dsn, ok := os.LookupEnv("POSTGRESQL_URL")
+	if !ok {
+		t.Skip("POSTGRESQL_URL is not set")
+	}
+
+	conn, err := db.OpenDB(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &DBModel{DB: conn}
+}
+
+// An admin of the Default organization must not be able to change, suspend or delete
+// the seeded super-admin, who is only a member of that organization
+func TestOrganizationAdminCannotWriteSuperAdmin(t *testing.T) {
+	m := testModel(t)
+
+	var userID, orgID int
+	var u ReplaceUserRequest
+
+	query := `
+		select u.id, o.id, u.first_name, u.last_name, u.email from users u, organizations o
+		where u.email = 'user@example.com' and o.name = 'Default'`
+
+	err := m.DB.QueryRowContext(context.Background(), query).Scan(&userID, &orgID, &u.FirstName, &u.LastName, &u.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.ReplaceUser(userID, orgID, u, "", nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("ReplaceUser: got %v, want %v", err, ErrGlobalUser)
+	}
+
+	if err := m.SetUserStatus(userID, orgID, "suspended", "test"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("SetUserStatus: got %v, want %v", err, ErrGlobalUser)
+	}
+
+	if _, err := m.DeleteUser(userID, orgID, nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("DeleteUser: got %v, want %v", err, ErrGlobalUser)
+	}
+}
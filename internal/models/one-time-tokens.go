@@ -0,0 +1,109 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Purposes a one time token can be issued for
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// OneTimeToken is the type for single use tokens sent to users by email, such as
+// email verification links. Like authentication tokens, only the hash is persisted
+type OneTimeToken struct {
+	ID        int
+	UserID    int
+	Purpose   string
+	PlainText string
+	Hash      string
+	Expiry    time.Time
+}
+
+// GenerateOneTimeToken generates a single use token for a purpose that lasts for ttl
+func GenerateOneTimeToken(userID int, purpose string, ttl time.Duration) (*OneTimeToken, error) {
+	plainText, hash, err := newTokenString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		PlainText: plainText,
+		Hash:      hash,
+		Expiry:    time.Now().Add(ttl),
+	}, nil
+}
+
+// InsertOneTimeToken saves a one time token
+func (m *DBModel) InsertOneTimeToken(t *OneTimeToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertOneTimeToken(ctx, m.DB, t)
+}
+
+// insertOneTimeToken saves a one time token, within a transaction or not
+func insertOneTimeToken(ctx context.Context, ex execer, t *OneTimeToken) error {
+	stmt := `
+		insert into one_time_tokens
+			(user_id, purpose, token_hash, expiry)
+		values ($1, $2, $3, $4)
+	`
+
+	_, err := ex.ExecContext(ctx, stmt, t.UserID, t.Purpose, t.Hash, t.Expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeOneTimeToken deletes a one time token issued for purpose and returns the id
+// of its user. Expired tokens are deleted too, but return an error
+func (m *DBModel) ConsumeOneTimeToken(plainText, purpose string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int
+	var expiry time.Time
+
+	stmt := `
+		delete from one_time_tokens
+		where token_hash = $1 and purpose = $2
+		returning user_id, expiry
+	`
+
+	err := m.DB.QueryRowContext(ctx, stmt, hashToken(plainText), purpose).Scan(&userID, &expiry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, NewError(ErrValidation, "invalid or already used token")
+	} else if err != nil {
+		return 0, err
+	}
+
+	if time.Now().After(localTime(expiry)) {
+		return 0, NewError(ErrValidation, "token expired")
+	}
+
+	return userID, nil
+}
+
+// DeleteOneTimeTokens deletes every outstanding one time token of a user for purpose
+func (m *DBModel) DeleteOneTimeTokens(userID int, purpose string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `delete from one_time_tokens where user_id = $1 and purpose = $2`
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, purpose)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
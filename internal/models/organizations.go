@@ -0,0 +1,198 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Organization is the type for customer organizations
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// Membership is the type for a user's membership of an organization, with the
+// scope the user holds within that organization
+type Membership struct {
+	ID             int       `json:"-"`
+	OrganizationID int       `json:"organization_id"`
+	UserID         int       `json:"user_id"`
+	Scope          string    `json:"scope"`
+	CreatedAt      time.Time `json:"-"`
+	UpdatedAt      time.Time `json:"-"`
+}
+
+// ErrOrganizationNotFound is returned for organizations that do not exist
+var ErrOrganizationNotFound error = &Error{Kind: ErrNotFound, Message: "organization not found"}
+
+// GetAllOrganizations gets all organizations ordered by name
+func (m *DBModel) GetAllOrganizations() ([]*Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var orgs []*Organization
+
+	query := `
+		select
+			id, name, created_at, updated_at
+		from
+			organizations
+		order by
+			name
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o Organization
+		err = rows.Scan(
+			&o.ID,
+			&o.Name,
+			&o.CreatedAt,
+			&o.UpdatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, &o)
+	}
+
+	return orgs, nil
+}
+
+// AddOrganization inserts a new organization and returns its id
+func (m *DBModel) AddOrganization(name string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+
+	stmt := `insert into organizations (name) values ($1) returning id`
+
+	if err := m.DB.QueryRowContext(ctx, stmt, name).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// AddMembership adds a user to an organization with the given scope, or updates
+// the user's scope if they are already a member
+func (m *DBModel) AddMembership(orgID, userID int, scope string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into memberships (organization_id, user_id, scope)
+		values ($1, $2, $3)
+		on conflict (organization_id, user_id) do update set scope = excluded.scope`
+
+	_, err := m.DB.ExecContext(ctx, stmt, orgID, userID, scope)
+
+	// a foreign key violation means there is no such organization or user
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return NewError(ErrNotFound, "organization or user not found")
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetMembershipsForUser gets every organization membership of a user
+func (m *DBModel) GetMembershipsForUser(userID int) ([]Membership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var memberships []Membership
+
+	query := `
+		select
+			id, organization_id, user_id, scope, created_at, updated_at
+		from
+			memberships
+		where user_id = $1
+		order by
+			organization_id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ms Membership
+		err = rows.Scan(
+			&ms.ID,
+			&ms.OrganizationID,
+			&ms.UserID,
+			&ms.Scope,
+			&ms.CreatedAt,
+			&ms.UpdatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, ms)
+	}
+
+	return memberships, nil
+}
+
+// GetMembershipForUser gets the membership of a user for the given organization.
+// If orgID is 0, the user's only membership is returned, which is ambiguous
+// for users belonging to more than one organization
+func (m *DBModel) GetMembershipForUser(userID, orgID int) (Membership, error) {
+	memberships, err := m.GetMembershipsForUser(userID)
+	if err != nil {
+		return Membership{}, err
+	}
+
+	if orgID == 0 {
+		switch len(memberships) {
+		case 0:
+			return Membership{}, NewError(ErrForbidden, "user is not a member of any organization")
+		case 1:
+			return memberships[0], nil
+		default:
+			return Membership{}, NewError(ErrValidation, "'organization_id' is required for users of multiple organizations")
+		}
+	}
+
+	for _, ms := range memberships {
+		if ms.OrganizationID == orgID {
+			return ms, nil
+		}
+	}
+
+	return Membership{}, NewError(ErrForbidden, "user is not a member of organization %d", orgID)
+}
+
+// updateMembershipScope sets the scope of a user within an organization, within a
+// transaction or not
+func updateMembershipScope(ctx context.Context, ex execer, userID, orgID int, scope string) error {
+	stmt := `update memberships set scope = $1 where user_id = $2 and organization_id = $3`
+
+	res, err := ex.ExecContext(ctx, stmt, scope, userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Cursor marks the position of the last row of a page by the values of the
+// columns the rows are sorted by, and the row's id to break ties
+type Cursor struct {
+	Values []string `json:"v"`
+	ID     int      `json:"id"`
+}
+
+// Encode returns the cursor as an opaque, url safe string
+func (c Cursor) Encode() string {
+	out, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+// ErrInvalidCursor is returned for cursors not returned by the same kind of query
+var ErrInvalidCursor error = &Error{Kind: ErrValidation, Message: "invalid cursor"}
+
+// DecodeCursor parses a cursor previously returned by Encode
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// queryArgs collects the arguments of a query built at runtime
+type queryArgs []any
+
+// add appends an argument and returns its placeholder
+func (a *queryArgs) add(v any) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// GetProfile gets the profile of a user. The organization and scope are those of the
+// user's token, so are left for the caller to fill in
+func (m *DBModel) GetProfile(userID int) (ProfileResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p ProfileResponse
+
+	query := `
+		select
+			id, first_name, last_name, email, email_verified_at is not null, totp_enabled, attributes, created_at
+		from
+			users
+		where id = $1 and deleted_at is null`
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&p.ID,
+		&p.FirstName,
+		&p.LastName,
+		&p.Email,
+		&p.EmailVerified,
+		&p.TwoFactorEnabled,
+		&p.Attributes,
+		&p.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrUserNotFound
+	} else if err != nil {
+		return p, err
+	}
+	return p, nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"strings"
+	"time"
 )
 
 // JSON Unmarshall will already validate the type when parsing
@@ -10,6 +11,12 @@ type TokenRequest struct {
 	Password string   `json:"password" validate:"required"`
 	Scope    []string `json:"scope" validate:"dive,scope"`
 	Expiry   int      `json:"expiry" validate:"gte=-55,lte=1380"`
+
+	// Organization to issue the token for, may be omitted for users of a single organization
+	OrganizationID int `json:"organization_id" validate:"gte=0"`
+
+	// TOTP code or recovery code, required for users with two-factor authentication enabled
+	OTP string `json:"otp" validate:"max=32"`
 }
 
 func (t *TokenRequest) Defaults() {
@@ -20,22 +27,195 @@ func (t *TokenRequest) Defaults() {
 	// Default value for expiry (int) is already set by JSON Unmarshall as 0
 }
 
-// Request body for updating a user record
+// Request body for creating a user record
+type CreateUserRequest struct {
+	FirstName string `json:"first_name" validate:"required,max=255"`
+	LastName  string `json:"last_name" validate:"required,max=255"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required,password"`
+
+	// Scope within the organization, none if omitted
+	Scope []string `json:"scope" validate:"dive,orgscope"`
+
+	// Custom profile attributes, validated against the user attributes schema
+	Attributes Attributes `json:"attributes,omitempty"`
+}
+
+// A user to import, like CreateUserRequest but the password is optional, so exported
+// users can be imported again. Users imported without a password are emailed a token
+// to set one
+type ImportUserRequest struct {
+	FirstName string   `json:"first_name" validate:"required,max=255"`
+	LastName  string   `json:"last_name" validate:"required,max=255"`
+	Email     string   `json:"email" validate:"required,email"`
+	Password  string   `json:"password" validate:"omitempty,password"`
+	Scope     []string `json:"scope" validate:"dive,orgscope"`
+
+	// Custom profile attributes, validated against the user attributes schema
+	Attributes Attributes `json:"attributes,omitempty"`
+}
+
+// Request body for inviting a user to an organization. Names are optional, and can be
+// given by the invitee when accepting
+type CreateInvitationRequest struct {
+	Email     string   `json:"email" validate:"required,email"`
+	FirstName string   `json:"first_name" validate:"max=255"`
+	LastName  string   `json:"last_name" validate:"max=255"`
+	Scope     []string `json:"scope" validate:"dive,orgscope"`
+}
+
+// Request body for accepting an invitation, names default to those of the invitation
+type AcceptInvitationRequest struct {
+	Token     string `json:"token" validate:"required,len=26"`
+	FirstName string `json:"first_name" validate:"max=255"`
+	LastName  string `json:"last_name" validate:"max=255"`
+	Password  string `json:"password" validate:"required,password"`
+}
+
+// Request body for self-service registration
+type RegisterRequest struct {
+	FirstName string `json:"first_name" validate:"required,max=255"`
+	LastName  string `json:"last_name" validate:"required,max=255"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required,password"`
+}
+
+// Request body for requesting a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// Request body for resetting a password with a password reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required,len=26"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+// Request body for confirming or disabling two-factor authentication
+type OTPRequest struct {
+	OTP string `json:"otp" validate:"required,max=32"`
+}
+
+// Request body for setting the scopes which require two-factor authentication
+type TwoFactorPolicyRequest struct {
+	Scope []string `json:"scope" validate:"required,dive,scope"`
+}
+
+// Fields of a user record to update with EditUser, each unchanged if empty
 type UpdateUserRequest struct {
 	FirstName string `json:"first_name,omitempty"`
 	LastName  string `json:"last_name,omitempty"`
 	Email     string `json:"email,omitempty" validate:"len=0|email"`
-	Password  string `json:"password,omitempty"`
+
+	// Custom profile attributes, replacing all existing attributes, unchanged if omitted
+	Attributes Attributes `json:"attributes,omitempty"`
 }
 
-// Trim leading and trailing whitespace from all fields
-func (u *UpdateUserRequest) Trim() {
+// Request body for replacing a user record with PUT, or the result of applying a merge
+// patch to one. Every field of the user is replaced, and omitted attributes are cleared
+type ReplaceUserRequest struct {
+	FirstName string `json:"first_name" validate:"required,max=255"`
+	LastName  string `json:"last_name" validate:"required,max=255"`
+	Email     string `json:"email" validate:"required,email"`
+
+	// Custom profile attributes, validated against the user attributes schema
+	Attributes Attributes `json:"attributes"`
+
+	// Write-only, the password is unchanged if omitted
+	Password string `json:"password,omitempty" validate:"omitempty,password"`
+
+	// Scope within the organization, unchanged if omitted and cleared if empty
+	Scope []string `json:"scope,omitempty" validate:"dive,orgscope"`
+
+	// What to do with existing tokens exceeding a new scope, defaults to 'keep'
+	Tokens string `json:"tokens,omitempty" validate:"omitempty,oneof=keep revoke narrow"`
+}
+
+// Trim leading and trailing whitespace from all fields except the password
+func (u *ReplaceUserRequest) Trim() {
 	u.FirstName = strings.TrimSpace(u.FirstName)
 	u.LastName = strings.TrimSpace(u.LastName)
 	u.Email = strings.TrimSpace(u.Email)
-	u.Password = strings.TrimSpace(u.Password)
 }
 
-func (u *UpdateUserRequest) IsEmpty() bool {
-	return *u == UpdateUserRequest{}
+// Request body for users updating their own profile. Email addresses can't be changed
+// here, as that would bypass their verification
+type UpdateProfileRequest struct {
+	FirstName string `json:"first_name,omitempty" validate:"max=255"`
+	LastName  string `json:"last_name,omitempty" validate:"max=255"`
+
+	// Custom profile attributes, replacing all existing attributes, unchanged if omitted
+	Attributes Attributes `json:"attributes,omitempty"`
+}
+
+// Trim leading and trailing whitespace from all fields
+func (u *UpdateProfileRequest) Trim() {
+	u.FirstName = strings.TrimSpace(u.FirstName)
+	u.LastName = strings.TrimSpace(u.LastName)
+}
+
+func (u *UpdateProfileRequest) IsEmpty() bool {
+	return u.FirstName == "" && u.LastName == "" && u.Attributes == nil
+}
+
+// Request body for users changing their own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,password"`
+}
+
+// Request body for creating an organization
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+// Request body for adding a user to an organization
+type AddMembershipRequest struct {
+	UserID int      `json:"user_id" validate:"required,gt=0"`
+	Scope  []string `json:"scope" validate:"dive,orgscope"`
+}
+
+// Request body for changing the status of a user
+type SetUserStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=active suspended disabled"`
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+// Query parameters choosing the representation of users, from '?fields=' (a comma
+// separated sparse fieldset) and '?include=' (related resources to embed)
+type UserRepresentation struct {
+	Fields  []string `validate:"dive,oneof=id first_name last_name email scope status status_reason status_changed_at email_verified_at last_login_at attributes user_since updated_at"`
+	Include []string `validate:"dive,oneof=tokens"`
+}
+
+// Query parameters for listing the token requests of a user
+type ListLoginsRequest struct {
+	Limit  int    `validate:"gte=1,lte=100"`
+	Cursor string `validate:"max=1024"`
+}
+
+// Query parameters for searching users
+type SearchUsersRequest struct {
+	UserRepresentation
+
+	Query  string `query:"q" validate:"required,max=255"`
+	Limit  int    `validate:"gte=1,lte=100"`
+	Cursor string `validate:"max=1024"`
+}
+
+// Query parameters for listing users
+type ListUsersRequest struct {
+	UserRepresentation
+
+	Limit         int    `validate:"gte=1,lte=100"`
+	Cursor        string `validate:"max=1024"`
+	Email         string `validate:"max=255"`
+	Scope         string `validate:"omitempty,scope"`
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          string `validate:"oneof=name email created_at"`
+	Order         string `validate:"oneof=asc desc"`
+
+	// Exact matches of attribute values, from 'attr.<name>=<value>' query parameters
+	Attributes map[string]string `validate:"dive,keys,max=64,endkeys,max=255"`
 }
@@ -2,9 +2,88 @@ package models
 
 import "time"
 
+// A user as returned by admin endpoints. Scope is the user's global scope and their
+// scope within the organization
 type GetUserResponse struct {
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"user_since"`
+	ID              int        `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Scope           []string   `json:"scope"`
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"status_reason"`
+	StatusChangedAt *time.Time `json:"status_changed_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	LastLoginAt     *time.Time `json:"last_login_at"`
+	Attributes      Attributes `json:"attributes"`
+	CreatedAt       time.Time  `json:"user_since"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// only with '?include=tokens'
+	Tokens []TokenSummary `json:"tokens"`
+
+	// the version of the user for its ETag, always read but never written
+	Version int `json:"-"`
+
+	// the fields to write, set when the user was read
+	fields []string
+}
+
+// A token embedded in a user, without the token itself
+type TokenSummary struct {
+	ID             int64     `json:"id"`
+	OrganizationID int64     `json:"organization_id"`
+	Scope          []string  `json:"scope"`
+	Expiry         time.Time `json:"expiry"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// The profile of the authenticated user, with the organization and scope of their token
+type ProfileResponse struct {
+	ID               int        `json:"id"`
+	FirstName        string     `json:"first_name"`
+	LastName         string     `json:"last_name"`
+	Email            string     `json:"email"`
+	EmailVerified    bool       `json:"email_verified"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	Attributes       Attributes `json:"attributes"`
+	OrganizationID   int64      `json:"organization_id"`
+	Scope            []string   `json:"scope"`
+	CreatedAt        time.Time  `json:"user_since"`
+}
+
+// A page of users, with a cursor for the next page if there is one
+type UserPage struct {
+	Users      []*GetUserResponse `json:"users"`
+	Total      int                `json:"total"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+	Next       string             `json:"next,omitempty"`
+}
+
+// A page of token requests, with a cursor for the next page if there is one
+type LoginPage struct {
+	Logins     []*LoginEvent `json:"logins"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Next       string        `json:"next,omitempty"`
+}
+
+// A user as exported by admins, in a form which can be imported again. Passwords are
+// never exported, so imported users are emailed a token to set a new one
+type ExportedUser struct {
+	ID         int        `json:"id"`
+	FirstName  string     `json:"first_name"`
+	LastName   string     `json:"last_name"`
+	Email      string     `json:"email"`
+	Scope      []string   `json:"scope"`
+	Status     string     `json:"status"`
+	Attributes Attributes `json:"attributes"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// The outcome of importing users. Invalid imports are a validation problem instead
+type ImportResult struct {
+	Error    bool   `json:"error"`
+	Message  string `json:"message"`
+	DryRun   bool   `json:"dry_run"`
+	Imported int    `json:"imported"`
 }
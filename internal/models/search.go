@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The text users are searched by, matching the expression of users_search_trgm_idx
+const userSearchDocument = `(first_name || ' ' || last_name || ' ' || email)`
+
+// SearchUsers gets a page of the users of an organization, or of every organization if
+// orgID is 0, whose name or email address contains the query or is similar to it. Users
+// containing the query rank first, then by how similar the closest word is
+func (m *DBModel) SearchUsers(orgID int, q SearchUsersRequest) (UserPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	page := UserPage{Users: []*GetUserResponse{}}
+
+	args := queryArgs{}
+	where := userFilters(orgID, ListUsersRequest{}, &args)
+
+	text := args.add(q.Query)
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q.Query)
+	contains := fmt.Sprintf(`%s ilike '%%' || %s::text || '%%'`, userSearchDocument, args.add(escaped))
+
+	where = append(where, fmt.Sprintf(`(%s or %s::text <%% %s)`, contains, text, userSearchDocument))
+
+	count := `select count(*) from users where ` + strings.Join(where, " and ")
+	if err := m.DB.QueryRowContext(ctx, count, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	rank := fmt.Sprintf(`((case when %s then 1 else 0 end) + word_similarity(%s::text, %s))::float8`,
+		contains, text, userSearchDocument)
+
+	// ranks are ordered descending and ids ascending, so rows can't be compared as a whole
+	if q.Cursor != "" {
+		c, err := DecodeCursor(q.Cursor)
+		if err != nil || len(c.Values) != 1 {
+			return page, ErrInvalidCursor
+		}
+
+		r, err := strconv.ParseFloat(c.Values[0], 64)
+		if err != nil {
+			return page, ErrInvalidCursor
+		}
+
+		p, id := args.add(r), args.add(c.ID)
+		where = append(where, fmt.Sprintf("(%[1]s < %[2]s or (%[1]s = %[2]s and id > %[3]s))", rank, p, id))
+	}
+
+	// userFilters adds the organization as the first argument
+	selected, dests := userColumns(q.fields(), []string{"id"}, "$1")
+
+	// fetch one extra row to know whether there is a next page
+	query := fmt.Sprintf(`
+		select
+			%s, %s
+		from
+			users
+		where %s
+		order by
+			1 desc, id asc
+		limit %s
+	`, rank, strings.Join(selected, ", "), strings.Join(where, " and "), args.add(q.Limit+1))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var ranks []float64
+	for rows.Next() {
+		var r float64
+		u := GetUserResponse{fields: q.output()}
+		if err := rows.Scan(append([]any{&r}, dests(&u)...)...); err != nil {
+			return page, err
+		}
+		ranks = append(ranks, r)
+		page.Users = append(page.Users, &u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Users) > q.Limit {
+		page.Users = page.Users[:q.Limit]
+		last := page.Users[q.Limit-1]
+		page.NextCursor = Cursor{Values: []string{strconv.FormatFloat(ranks[q.Limit-1], 'g', -1, 64)}, ID: last.ID}.Encode()
+	}
+
+	if slices.Contains(q.Include, "tokens") && len(page.Users) > 0 {
+		if err := m.includeTokens(page.Users, orgID); err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
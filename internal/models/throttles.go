@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ThrottlePolicy configures how failed logins are throttled. Once a key has more than
+// FreeAttempts failures within Window, each further failure locks it for an exponentially
+// increasing delay, starting at BaseDelay and capped at MaxDelay
+type ThrottlePolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+// Delay returns how long a key with the given number of failures is locked for
+func (p ThrottlePolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, p.MaxDelay)
+}
+
+// GetLockout returns the longest time any of the keys remains locked for
+func (m *DBModel) GetLockout(keys ...string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ms int64
+
+	query := `
+		select
+			coalesce(max(extract(epoch from locked_until - now()) * 1000), 0)::bigint
+		from
+			login_throttles
+		where key = any($1) and locked_until > now()
+	`
+
+	if err := m.DB.QueryRowContext(ctx, query, pq.Array(keys)).Scan(&ms); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// RecordLoginFailure counts a failed login for a key, locking it if the policy says so,
+// and returns how long the key is now locked for. Failures older than the policy's
+// window are forgotten
+func (m *DBModel) RecordLoginFailure(key string, p ThrottlePolicy) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var failures int
+
+	stmt := `
+		insert into login_throttles (key, failures, last_failure_at)
+		values ($1, 1, now())
+		on conflict (key) do update set
+			failures = case
+				when login_throttles.last_failure_at < now() - $2::float8 * interval '1 millisecond' then 1
+				else login_throttles.failures + 1
+			end,
+			last_failure_at = now()
+		returning failures
+	`
+
+	if err := m.DB.QueryRowContext(ctx, stmt, key, p.Window.Milliseconds()).Scan(&failures); err != nil {
+		return 0, err
+	}
+
+	delay := p.Delay(failures)
+	if delay == 0 {
+		return 0, nil
+	}
+
+	stmt = `update login_throttles set locked_until = now() + $2::float8 * interval '1 millisecond' where key = $1`
+
+	if _, err := m.DB.ExecContext(ctx, stmt, key, delay.Milliseconds()); err != nil {
+		return 0, err
+	}
+
+	return delay, nil
+}
+
+// ClearLoginFailures forgets the failed logins of a key, unlocking it
+func (m *DBModel) ClearLoginFailures(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `delete from login_throttles where key = $1`
+
+	_, err := m.DB.ExecContext(ctx, stmt, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
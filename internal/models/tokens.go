@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/base32"
 	"encoding/hex"
 	"errors"
@@ -16,14 +17,18 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// ErrUserInactive is returned for tokens of users who are not active
+var ErrUserInactive error = &Error{Kind: ErrForbidden, Message: "user inactive"}
+
 // Token is the type for authentication tokens
 type Token struct {
-	ID        int64     `json:"-"`
-	UserID    int64     `json:"-"`
-	PlainText string    `json:"token"`
-	Hash      string    `json:"-"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     []string  `json:"scope"`
+	ID             int64     `json:"-"`
+	UserID         int64     `json:"-"`
+	OrganizationID int64     `json:"organization_id"`
+	PlainText      string    `json:"token"`
+	Hash           string    `json:"-"`
+	Expiry         time.Time `json:"expiry"`
+	Scope          []string  `json:"scope"`
 }
 
 func (t Token) HasScope(scope []string) error {
@@ -37,43 +42,126 @@ func (t Token) HasScope(scope []string) error {
 	return nil
 }
 
-// GenerateToken generates a token that lasts for ttl, and returns it
-func GenerateToken(userID int, ttl time.Duration, scope []string) (*Token, error) {
+// GenerateToken generates a token for an organization that lasts for ttl, and returns it
+func GenerateToken(userID, orgID int, ttl time.Duration, scope []string) (*Token, error) {
 	token := &Token{
-		UserID: int64(userID),
-		Expiry: time.Now().Add(ttl),
-		Scope:  scope,
+		UserID:         int64(userID),
+		OrganizationID: int64(orgID),
+		Expiry:         time.Now().Add(ttl),
+		Scope:          scope,
 	}
 
-	randomBytes := make([]byte, 16)
-	_, err := rand.Read(randomBytes)
+	plainText, hash, err := newTokenString()
 	if err != nil {
 		return nil, err
 	}
 
-	token.PlainText = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
-	hash := sha256.Sum256([]byte(token.PlainText))
-	token.Hash = hex.EncodeToString(hash[:])
+	token.PlainText = plainText
+	token.Hash = hash
 	return token, nil
 }
 
+// newTokenString generates a random 26 character token, and its SHA-256 hash to persist
+func newTokenString() (string, string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", "", err
+	}
+
+	plainText := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	return plainText, hashToken(plainText), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a plain text token
+func hashToken(plainText string) string {
+	hash := sha256.Sum256([]byte(plainText))
+	return hex.EncodeToString(hash[:])
+}
+
+// localTime reads a time stored in a column without time zone as local time
+func localTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(),
+		t.Minute(), t.Second(), 0, utils.Location)
+}
+
 func (m *DBModel) InsertToken(t *Token, u User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	stmt := `
 		insert into tokens 
-			(user_id, token_hash, scope, expiry)
-		values ($1, $2, $3, $4)
+			(user_id, organization_id, token_hash, scope, expiry)
+		values ($1, $2, $3, $4, $5)
 	`
 
 	scope := strings.Join(t.Scope, ",")
-	_, err := m.DB.ExecContext(ctx, stmt, u.ID, t.Hash, scope, t.Expiry)
+	_, err := m.DB.ExecContext(ctx, stmt, u.ID, t.OrganizationID, t.Hash, scope, t.Expiry)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// restrictTokens finds the tokens of a user within an organization holding scope outside
+// of allowed (or the user's global scope), and either deletes them (revoke) or removes
+// the excess scope from them, within a transaction
+func restrictTokens(ctx context.Context, tx *sql.Tx, userID, orgID int, allowed []string, revoke bool) error {
+	query := `
+		select
+			t.id, t.scope, u.scope
+		from
+			tokens t
+			inner join users u on (u.id = t.user_id)
+		where
+			t.user_id = $1 and t.organization_id = $2
+	`
 
+	rows, err := tx.QueryContext(ctx, query, userID, orgID)
 	if err != nil {
 		return err
 	}
 
+	narrowed := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var scope, userScope string
+		if err := rows.Scan(&id, &scope, &userScope); err != nil {
+			rows.Close()
+			return err
+		}
+
+		global := strings.Split(userScope, ",")
+		kept := []string{}
+		for _, s := range strings.Split(scope, ",") {
+			if s != "" && (slices.Contains(allowed, s) || slices.Contains(global, s)) {
+				kept = append(kept, s)
+			}
+		}
+
+		if k := strings.Join(kept, ","); k != scope {
+			narrowed[id] = k
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, scope := range narrowed {
+		if revoke {
+			_, err = tx.ExecContext(ctx, `delete from tokens where id = $1`, id)
+		} else {
+			_, err = tx.ExecContext(ctx, `update tokens set scope = $1 where id = $2`, scope, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -92,12 +180,42 @@ func (m *DBModel) DeleteToken(t *Token) error {
 	return nil
 }
 
-func (m *DBModel) GetUserForToken(tokenStr string) (*User, *Token, error) {
+// DeleteTokensForUser deletes every authentication token of a user
+func (m *DBModel) DeleteTokensForUser(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `delete from tokens where user_id = $1`
+	_, err := m.DB.ExecContext(ctx, stmt, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteOtherTokensForUser deletes every authentication token of a user except one,
+// logging them out everywhere else
+func (m *DBModel) DeleteOtherTokensForUser(userID int, keepTokenID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// convert plain text token into hash
-	tokenHash := sha256.Sum256([]byte(tokenStr))
+	stmt := `delete from tokens where user_id = $1 and id <> $2`
+	_, err := m.DB.ExecContext(ctx, stmt, userID, keepTokenID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetUserForToken gets the user and token for a plain text token. The token is only
+// valid while the user remains a member of the token's organization
+func (m *DBModel) GetUserForToken(tokenStr string) (*User, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
 	var user User
 	var token Token = Token{PlainText: tokenStr}
@@ -106,21 +224,25 @@ func (m *DBModel) GetUserForToken(tokenStr string) (*User, *Token, error) {
 
 	query := `
 	SELECT
-		t.id, u.id, u.first_name, u.last_name, u.email, t.expiry, t.scope
+		t.id, t.organization_id, u.id, u.first_name, u.last_name, u.email, u.scope, u.status, t.expiry, t.scope
 	FROM
 		users u
 		INNER JOIN tokens t ON (u.id = t.user_id)
+		INNER JOIN memberships m ON (m.user_id = t.user_id AND m.organization_id = t.organization_id)
 	WHERE
-		t.token_hash = $1
+		t.token_hash = $1 AND u.deleted_at IS NULL
 
 	`
 
-	err := m.DB.QueryRowContext(ctx, query, hex.EncodeToString(tokenHash[:])).Scan(
+	err := m.DB.QueryRowContext(ctx, query, hashToken(tokenStr)).Scan(
 		&token.ID,
+		&token.OrganizationID,
 		&user.ID,
 		&user.FirstName,
 		&user.LastName,
 		&user.Email,
+		&user.Scope,
+		&user.Status,
 		&expiry,
 		&scope)
 
@@ -129,8 +251,12 @@ func (m *DBModel) GetUserForToken(tokenStr string) (*User, *Token, error) {
 		return nil, nil, err
 	}
 
-	token.Expiry = time.Date(expiry.Year(), expiry.Month(), expiry.Day(), expiry.Hour(),
-		expiry.Minute(), expiry.Second(), 0, utils.Location)
+	// tokens of suspended or disabled users stop working immediately
+	if user.Status != StatusActive {
+		return nil, nil, fmt.Errorf("%w: user account is %s", ErrUserInactive, user.Status)
+	}
+
+	token.Expiry = localTime(expiry)
 
 	if time.Now().After(token.Expiry) {
 		defer m.DeleteToken(&token)
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// GenerateRecoveryCodes generates n single use recovery codes, formatted for users as
+// 'xxxxx-xxxxx', and their hashes to persist
+func GenerateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+
+	for range n {
+		randomBytes := make([]byte, 7)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips the formatting users may or may not type
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// GetUserTOTP gets the TOTP secret of a user and whether two-factor authentication is enabled
+func (m *DBModel) GetUserTOTP(userID int) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var secret string
+	var enabled bool
+
+	query := `select totp_secret, totp_enabled from users where id = $1 and deleted_at is null`
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&secret, &enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, ErrUserNotFound
+	} else if err != nil {
+		return "", false, err
+	}
+
+	return secret, enabled, nil
+}
+
+// SetTOTPSecret saves a new, not yet confirmed TOTP secret for a user without two-factor
+// authentication enabled
+func (m *DBModel) SetTOTPSecret(userID int, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update users set totp_secret = $1 where id = $2 and not totp_enabled`
+
+	res, err := m.DB.ExecContext(ctx, stmt, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return NewError(ErrConflict, "two-factor authentication is already enabled")
+	}
+
+	return nil
+}
+
+// EnableTOTP enables two-factor authentication for a user, replacing their recovery
+// codes, and records the time step of the code used to confirm it
+func (m *DBModel) EnableTOTP(userID int, counter int64, codeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update users set totp_enabled = true, totp_last_counter = $1 where id = $2 and totp_secret <> ''`
+
+	res, err := tx.ExecContext(ctx, stmt, counter, userID)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return NewError(ErrConflict, "two-factor authentication has not been enrolled")
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		stmt = `insert into recovery_codes (user_id, code_hash) values ($1, $2)`
+		if _, err := tx.ExecContext(ctx, stmt, userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP disables two-factor authentication for a user and deletes their recovery codes
+func (m *DBModel) DisableTOTP(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update users set totp_enabled = false, totp_secret = '', totp_last_counter = 0 where id = $1`
+	if _, err := tx.ExecContext(ctx, stmt, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPCounter records a time step as used, returning false if it (or a later one)
+// was already used, so each code can only be used once
+func (m *DBModel) UseTOTPCounter(userID int, counter int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update users set totp_last_counter = $1 where id = $2 and totp_last_counter < $1`
+
+	res, err := m.DB.ExecContext(ctx, stmt, counter, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used, returning false if
+// there was no such code
+func (m *DBModel) UseRecoveryCode(userID int, code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		update recovery_codes set used_at = now()
+		where user_id = $1 and code_hash = $2 and used_at is null`
+
+	res, err := m.DB.ExecContext(ctx, stmt, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// GetRequired2FAScope gets the scopes of an organization which can only be requested
+// by users with two-factor authentication enabled
+func (m *DBModel) GetRequired2FAScope(orgID int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var scope string
+
+	query := `select require_2fa_scope from organizations where id = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, orgID).Scan(&scope)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrganizationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if scope == "" {
+		return []string{}, nil
+	}
+
+	return strings.Split(scope, ","), nil
+}
+
+// SetRequired2FAScope sets the scopes of an organization which can only be requested
+// by users with two-factor authentication enabled
+func (m *DBModel) SetRequired2FAScope(orgID int, scope []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update organizations set require_2fa_scope = $1 where id = $2`
+
+	res, err := m.DB.ExecContext(ctx, stmt, strings.Join(scope, ","), orgID)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrOrganizationNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UserFieldNames are the fields of the user representation, in the order they are
+// selected. Every field is returned unless a request asks for a sparse fieldset
+var UserFieldNames = []string{
+	"id", "first_name", "last_name", "email", "scope", "status", "status_reason", "status_changed_at",
+	"email_verified_at", "last_login_at", "attributes", "user_since", "updated_at",
+}
+
+// UserIncludes are the related resources which can be embedded in the user representation
+var UserIncludes = []string{"tokens"}
+
+// userField is a field of the user representation and the column it is selected from.
+// Columns may reference the organization placeholder as {org}
+type userField struct {
+	column string
+	dest   func(u *GetUserResponse) any
+}
+
+var userFields = map[string]userField{
+	"id":                {"id", func(u *GetUserResponse) any { return &u.ID }},
+	"first_name":        {"first_name", func(u *GetUserResponse) any { return &u.FirstName }},
+	"last_name":         {"last_name", func(u *GetUserResponse) any { return &u.LastName }},
+	"email":             {"email", func(u *GetUserResponse) any { return &u.Email }},
+	"status":            {"status", func(u *GetUserResponse) any { return &u.Status }},
+	"status_reason":     {"status_reason", func(u *GetUserResponse) any { return &u.StatusReason }},
+	"status_changed_at": {"status_changed_at", func(u *GetUserResponse) any { return &u.StatusChangedAt }},
+	"email_verified_at": {"email_verified_at", func(u *GetUserResponse) any { return &u.EmailVerifiedAt }},
+	"last_login_at": {`(select max(e.created_at) from login_events e where e.user_id = users.id and e.success)`,
+		func(u *GetUserResponse) any { return &u.LastLoginAt }},
+	"attributes": {"attributes", func(u *GetUserResponse) any { return &u.Attributes }},
+	"user_since": {"created_at", func(u *GetUserResponse) any { return &u.CreatedAt }},
+	"updated_at": {"updated_at", func(u *GetUserResponse) any { return &u.UpdatedAt }},
+
+	// not part of the representation, only selected as an extra field
+	"version": {"version", func(u *GetUserResponse) any { return &u.Version }},
+
+	// the user's global scope and their scope within the organization, or within every
+	// organization if the organization is 0
+	"scope": {`array(select distinct s from unnest(string_to_array(users.scope, ',') || array(
+			select unnest(string_to_array(m.scope, ',')) from memberships m
+			where m.user_id = users.id and ({org} = 0 or m.organization_id = {org}))) s
+		where s <> '' order by s)`, func(u *GetUserResponse) any { return pq.Array(&u.Scope) }},
+}
+
+// Fields of the user representation needed to position a cursor, for each sort field
+var userSortFields = map[string][]string{
+	"name":       {"last_name", "first_name"},
+	"email":      {"email"},
+	"created_at": {"user_since"},
+}
+
+// fields returns the fields of the user representation requested, defaulting to all
+func (rep UserRepresentation) fields() []string {
+	if len(rep.Fields) == 0 {
+		return UserFieldNames
+	}
+	return rep.Fields
+}
+
+// output returns the fields of the user representation to write, including embeds
+func (rep UserRepresentation) output() []string {
+	return append(slices.Clone(rep.fields()), rep.Include...)
+}
+
+// userColumns returns the columns to select for the requested fields, along with any
+// extra fields needed internally, and the scan destinations of a user for each column
+func userColumns(fields []string, extra []string, org string) ([]string, func(u *GetUserResponse) []any) {
+	var selected []string
+	for _, name := range UserFieldNames {
+		if slices.Contains(fields, name) || slices.Contains(extra, name) {
+			selected = append(selected, name)
+		}
+	}
+	for _, name := range extra {
+		if !slices.Contains(UserFieldNames, name) {
+			selected = append(selected, name)
+		}
+	}
+
+	columns := make([]string, 0, len(selected))
+	for _, name := range selected {
+		columns = append(columns, strings.ReplaceAll(userFields[name].column, "{org}", org))
+	}
+
+	dests := func(u *GetUserResponse) []any {
+		out := make([]any, 0, len(selected))
+		for _, name := range selected {
+			out = append(out, userFields[name].dest(u))
+		}
+		return out
+	}
+
+	return columns, dests
+}
+
+// MarshalJSON only writes the requested fields of users read with a sparse fieldset
+func (u GetUserResponse) MarshalJSON() ([]byte, error) {
+	type plain GetUserResponse
+
+	out, err := json.Marshal(plain(u))
+	if err != nil || u.fields == nil {
+		return out, err
+	}
+
+	all := map[string]json.RawMessage{}
+	if err := json.Unmarshal(out, &all); err != nil {
+		return nil, err
+	}
+
+	// written by hand to keep the fields in order
+	var sparse bytes.Buffer
+	sparse.WriteByte('{')
+	for _, name := range u.fields {
+		if v, ok := all[name]; ok {
+			if sparse.Len() > 1 {
+				sparse.WriteByte(',')
+			}
+			key, _ := json.Marshal(name)
+			sparse.Write(key)
+			sparse.WriteByte(':')
+			sparse.Write(v)
+		}
+	}
+	sparse.WriteByte('}')
+
+	return sparse.Bytes(), nil
+}
+
+// includeTokens embeds the tokens of each user within the organization, or within every
+// organization if orgID is 0
+func (m *DBModel) includeTokens(users []*GetUserResponse, orgID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	byID := map[int]*GetUserResponse{}
+	ids := make([]int64, 0, len(users))
+	for _, u := range users {
+		u.Tokens = []TokenSummary{}
+		byID[u.ID] = u
+		ids = append(ids, int64(u.ID))
+	}
+
+	query := `
+		select
+			id, user_id, organization_id, coalesce(scope, ''), expiry, created_at
+		from
+			tokens
+		where user_id = any($1) and ($2 = 0 or organization_id = $2)
+		order by
+			id`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids), orgID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TokenSummary
+		var userID int
+		var scope string
+		var expiry time.Time
+
+		if err := rows.Scan(&t.ID, &userID, &t.OrganizationID, &scope, &expiry, &t.CreatedAt); err != nil {
+			return err
+		}
+
+		t.Expiry = localTime(expiry)
+		t.Scope = []string{}
+		if scope != "" {
+			t.Scope = strings.Split(scope, ",")
+		}
+
+		if u, ok := byID[userID]; ok {
+			u.Tokens = append(u.Tokens, t)
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,145 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported hashing algorithms
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Argon2Params are the parameters of argon2id hashes
+type Argon2Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Hasher hashes new passwords with the configured algorithm and parameters, and verifies
+// passwords against hashes made by any supported algorithm. Hashes are PHC format strings
+// ('$argon2id$v=19$m=...,t=...,p=...$salt$hash'), or the equivalent bcrypt format ('$2a$...')
+type Hasher struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// Hash hashes a password with the configured algorithm
+func (h *Hasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case Argon2id:
+		salt := make([]byte, h.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		p := h.Argon2
+		key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hash), err
+	default:
+		return "", fmt.Errorf("unknown password hashing algorithm '%s'", h.Algorithm)
+	}
+}
+
+// Verify checks a password against a hash made by any supported algorithm. An empty hash
+// is an account without a usable password, which no password matches
+func (h *Hasher) Verify(hash, password string) (bool, error) {
+	if hash == "" {
+		return false, nil
+	}
+
+	if strings.HasPrefix(hash, "$argon2id$") {
+		p, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	}
+
+	if strings.HasPrefix(hash, "$2") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, ErrUnknownHash
+}
+
+// NeedsRehash reports whether a hash was made with a different algorithm or parameters
+// than the configured ones, so the password should be hashed again when next known
+func (h *Hasher) NeedsRehash(hash string) bool {
+	switch h.Algorithm {
+	case Argon2id:
+		p, _, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return true
+		}
+		return p.Memory != h.Argon2.Memory || p.Iterations != h.Argon2.Iterations ||
+			p.Parallelism != h.Argon2.Parallelism || uint32(len(key)) != h.Argon2.KeyLength
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.BcryptCost
+	default:
+		return false
+	}
+}
+
+// decodeArgon2id parses an argon2id PHC string into its parameters, salt and key
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	var version int
+
+	// '', 'argon2id', 'v=19', 'm=...,t=...,p=...', salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
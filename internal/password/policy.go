@@ -0,0 +1,102 @@
+// Package password implements the policy every new password must satisfy
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Policy is the set of rules a new password must satisfy
+type Policy struct {
+	MinLength  int // minimum length in characters
+	MaxBytes   int // bcrypt ignores everything after 72 bytes
+	MinClasses int // minimum number of lowercase, uppercase, digit and symbol classes used
+
+	// SHA-1 hashes of known breached passwords
+	breached map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreached loads a list of breached password SHA-1 hashes, one hex encoded hash
+// per line. Lines in the 'HASH:COUNT' format of the Have I Been Pwned downloads are
+// accepted, and blank lines or lines starting with '#' are ignored
+func (p *Policy) LoadBreached(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p.breached = map[[sha1.Size]byte]struct{}{}
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(text, ":")
+
+		var key [sha1.Size]byte
+		if n, err := hex.Decode(key[:], []byte(hash)); err != nil || n != sha1.Size {
+			return fmt.Errorf("%s:%d: invalid SHA-1 hash", path, line)
+		}
+		p.breached[key] = struct{}{}
+	}
+
+	return scanner.Err()
+}
+
+// Check returns why a password does not satisfy the policy, or nil if it does
+func (p *Policy) Check(password string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return fmt.Errorf("password must be at most %d bytes long", p.MaxBytes)
+	}
+
+	if n := classes(password); n < p.MinClasses {
+		return fmt.Errorf("password must use at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses)
+	}
+
+	if _, ok := p.breached[sha1.Sum([]byte(password))]; ok {
+		return fmt.Errorf("password has appeared in a data breach, choose another")
+	}
+
+	return nil
+}
+
+// Validate is the 'password' validation for the validator package
+func (p *Policy) Validate(fl validator.FieldLevel) bool {
+	return p.Check(fl.Field().String()) == nil
+}
+
+// classes counts the character classes used by a password
+func classes(password string) int {
+	var lower, upper, digit, symbol int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
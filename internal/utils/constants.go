@@ -3,10 +3,26 @@ package utils
 import "time"
 
 var (
-	ValidScopes = [...]string{"read:a", "read:b", "write:a", "write:b"}
+	ValidScopes = [...]string{"read:a", "read:b", "write:a", "write:b", SUPER_ADMIN_SCOPE}
 	Location    = time.Now().Location()
+
+	// Valid scopes which can be granted within an organization
+	OrganizationScopes = []string{"read:a", "read:b", "write:a", "write:b"}
+
+	// Human readable descriptions of each valid scope
+	ScopeDescriptions = map[string]string{
+		"read:a":          "Read access to resource A",
+		"read:b":          "Read access to resource B",
+		"write:a":         "Write access to resource A",
+		"write:b":         "Write access to resource B",
+		SUPER_ADMIN_SCOPE: "Access to users and organizations across all organizations",
+	}
 )
 
 const (
 	API_VERSION = "1.0.0"
+
+	// Scope granting access to users and organizations across all organizations.
+	// It can only be held as a global user scope, never as an organization scope
+	SUPER_ADMIN_SCOPE = "super:admin"
 )
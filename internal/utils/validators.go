@@ -13,3 +13,9 @@ func ValidateScope(fl validator.FieldLevel) bool {
 	}
 	return false
 }
+
+// ValidateOrganizationScope validates scope granted within an organization, which can
+// be any valid scope except the super-admin scope
+func ValidateOrganizationScope(fl validator.FieldLevel) bool {
+	return ValidateScope(fl) && fl.Field().String() != SUPER_ADMIN_SCOPE
+}
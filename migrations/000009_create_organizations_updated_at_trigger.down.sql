@@ -0,0 +1 @@
+DROP TRIGGER IF EXISTS organizations_updated_at_trigger ON organizations;
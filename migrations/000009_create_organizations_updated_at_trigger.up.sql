@@ -0,0 +1,6 @@
+CREATE OR REPLACE TRIGGER organizations_updated_at_trigger
+    BEFORE UPDATE
+    ON
+        organizations
+    FOR EACH ROW
+EXECUTE PROCEDURE auto_set_update_at();
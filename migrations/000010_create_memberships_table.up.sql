@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS memberships (
+  id SERIAL PRIMARY KEY,
+  organization_id int NOT NULL,
+  user_id int NOT NULL,
+  scope varchar(255) NOT NULL DEFAULT '',
+  created_at timestamp NOT NULL DEFAULT NOW(),
+  updated_at timestamp NOT NULL DEFAULT NOW(),
+  UNIQUE (organization_id, user_id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS memberships 
+  DROP CONSTRAINT IF EXISTS fk_membership_organizations,
+  DROP CONSTRAINT IF EXISTS fk_membership_users;
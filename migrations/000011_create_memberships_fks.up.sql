@@ -0,0 +1,3 @@
+ALTER TABLE memberships
+    ADD CONSTRAINT fk_membership_organizations FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_membership_users FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+DROP TRIGGER IF EXISTS memberships_updated_at_trigger ON memberships;
@@ -0,0 +1,6 @@
+CREATE OR REPLACE TRIGGER memberships_updated_at_trigger
+    BEFORE UPDATE
+    ON
+        memberships
+    FOR EACH ROW
+EXECUTE PROCEDURE auto_set_update_at();
@@ -0,0 +1,6 @@
+UPDATE users u SET scope = m.scope
+FROM memberships m
+INNER JOIN organizations o ON (o.id = m.organization_id)
+WHERE m.user_id = u.id AND o.name = 'Default';
+
+DELETE FROM organizations WHERE name = 'Default';
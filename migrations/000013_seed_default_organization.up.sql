@@ -0,0 +1,11 @@
+-- Every existing user becomes a member of a default organization, keeping
+-- their current scope as their scope within that organization
+INSERT INTO organizations (name) VALUES ('Default');
+
+INSERT INTO memberships
+(organization_id, user_id, scope)
+SELECT o.id, u.id, u.scope FROM users u, organizations o WHERE o.name = 'Default';
+
+-- users.scope now only holds global (cross-organization) scope
+UPDATE users SET scope = '';
+UPDATE users SET scope = 'super:admin' WHERE email = 'user@example.com';
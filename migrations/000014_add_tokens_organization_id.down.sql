@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS tokens 
+  DROP CONSTRAINT IF EXISTS fk_token_organizations,
+  DROP COLUMN IF EXISTS organization_id;
@@ -0,0 +1,7 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS organization_id int;
+
+UPDATE tokens SET organization_id = (SELECT id FROM organizations WHERE name = 'Default');
+
+ALTER TABLE tokens
+    ALTER COLUMN organization_id SET NOT NULL,
+    ADD CONSTRAINT fk_token_organizations FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS email_verified_at;
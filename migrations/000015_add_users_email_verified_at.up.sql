@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at timestamp;
+
+-- Users created before registration existed were created by an admin
+UPDATE users SET email_verified_at = NOW();
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS one_time_tokens (
+  id SERIAL PRIMARY KEY,
+  user_id int NOT NULL,
+  purpose varchar(32) NOT NULL,
+  token_hash char(64) NOT NULL UNIQUE,
+  created_at timestamp NOT NULL DEFAULT NOW(),
+  expiry timestamp NOT NULL
+);
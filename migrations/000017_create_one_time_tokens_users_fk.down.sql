@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS one_time_tokens 
+  DROP CONSTRAINT IF EXISTS fk_one_time_token_users;
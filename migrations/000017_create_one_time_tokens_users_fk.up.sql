@@ -0,0 +1,2 @@
+ALTER TABLE one_time_tokens
+    ADD CONSTRAINT fk_one_time_token_users FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+-- Failed login attempts per account ('email:...') and per source IP ('ip:...')
+CREATE TABLE IF NOT EXISTS login_throttles (
+  key varchar(320) PRIMARY KEY,
+  failures int NOT NULL DEFAULT 0,
+  last_failure_at timestamptz NOT NULL DEFAULT NOW(),
+  locked_until timestamptz
+);
@@ -0,0 +1,4 @@
+-- Soft deleted users would otherwise reappear
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS deleted_at;
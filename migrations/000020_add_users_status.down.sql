@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS users
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS status_reason,
+    DROP COLUMN IF EXISTS status_changed_at;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'suspended', 'disabled')),
+    ADD COLUMN IF NOT EXISTS status_reason varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status_changed_at timestamp;
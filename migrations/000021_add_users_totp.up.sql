@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret varchar(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS totp_enabled boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS totp_last_counter bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id SERIAL PRIMARY KEY,
+  user_id int NOT NULL,
+  code_hash char(64) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT NOW(),
+  used_at timestamp
+);
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS recovery_codes 
+  DROP CONSTRAINT IF EXISTS fk_recovery_code_users;
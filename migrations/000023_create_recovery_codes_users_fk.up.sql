@@ -0,0 +1,2 @@
+ALTER TABLE recovery_codes
+    ADD CONSTRAINT fk_recovery_code_users FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS organizations DROP COLUMN IF EXISTS require_2fa_scope;
@@ -0,0 +1,2 @@
+-- Users must have two-factor authentication enabled to request tokens with any of these scopes
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS require_2fa_scope varchar(255) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Fails if any password is no longer a bcrypt hash
+ALTER TABLE users ALTER COLUMN password TYPE char(60);
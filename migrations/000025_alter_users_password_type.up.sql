@@ -0,0 +1,2 @@
+-- PHC format hashes (e.g argon2id) are longer than the 60 characters of bcrypt hashes
+ALTER TABLE users ALTER COLUMN password TYPE varchar(255);
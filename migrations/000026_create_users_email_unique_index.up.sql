@@ -0,0 +1,24 @@
+-- Report every group of users whose emails only differ by case, instead of failing
+-- on the first duplicate. These must be resolved by hand before migrating
+DO $$
+DECLARE
+    conflicts text;
+BEGIN
+    SELECT string_agg(format('%s (user ids %s)', email, ids), ', ')
+    INTO conflicts
+    FROM (
+        SELECT lower(email) AS email, string_agg(id::text, ', ' ORDER BY id) AS ids
+        FROM users
+        WHERE deleted_at IS NULL
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) duplicates;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'users with conflicting emails must be merged or deleted first: %', conflicts;
+    END IF;
+END $$;
+
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_unique_idx ON users (lower(email)) WHERE deleted_at IS NULL;
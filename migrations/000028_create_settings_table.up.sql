@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS settings (
+  key varchar(64) PRIMARY KEY,
+  value jsonb NOT NULL,
+  created_at timestamp NOT NULL DEFAULT NOW(),
+  updated_at timestamp NOT NULL DEFAULT NOW()
+);
+
+-- JSON schema user attributes are validated against, allowing anything by default
+INSERT INTO settings (key, value) VALUES ('user_attributes_schema', '{"type": "object"}')
+ON CONFLICT (key) DO NOTHING;
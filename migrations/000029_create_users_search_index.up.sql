@@ -0,0 +1,7 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Trigram index on the text users are searched by, for both ilike and similarity matches.
+-- The expression must match the search document in internal/models/search.go
+CREATE INDEX IF NOT EXISTS users_search_trgm_idx ON users
+    USING gin ((first_name || ' ' || last_name || ' ' || email) gin_trgm_ops)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS invitations (
+  id SERIAL PRIMARY KEY,
+  organization_id int NOT NULL,
+  invited_by int,
+  email varchar(255) NOT NULL,
+  first_name varchar(255) NOT NULL DEFAULT '',
+  last_name varchar(255) NOT NULL DEFAULT '',
+  scope varchar(255) NOT NULL DEFAULT '',
+  token_hash char(64) NOT NULL UNIQUE,
+  expiry timestamp NOT NULL,
+  accepted_at timestamp,
+  revoked_at timestamp,
+  created_at timestamp NOT NULL DEFAULT NOW(),
+  updated_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitations_organization_email_idx ON invitations (organization_id, lower(email));
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS invitations
+  DROP CONSTRAINT IF EXISTS fk_invitation_organizations,
+  DROP CONSTRAINT IF EXISTS fk_invitation_users;
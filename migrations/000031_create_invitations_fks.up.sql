@@ -0,0 +1,3 @@
+ALTER TABLE invitations
+    ADD CONSTRAINT fk_invitation_organizations FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_invitation_users FOREIGN KEY (invited_by) REFERENCES users (id) ON DELETE SET NULL;
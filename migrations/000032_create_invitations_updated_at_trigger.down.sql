@@ -0,0 +1 @@
+DROP TRIGGER IF EXISTS invitations_updated_at_trigger ON invitations;
@@ -0,0 +1,13 @@
+-- Every token request, successful or not. user_id is null for unknown email addresses
+CREATE TABLE IF NOT EXISTS login_events (
+  id SERIAL PRIMARY KEY,
+  user_id int,
+  email varchar(255) NOT NULL,
+  success boolean NOT NULL,
+  reason varchar(32) NOT NULL DEFAULT '',
+  ip varchar(64) NOT NULL DEFAULT '',
+  user_agent varchar(255) NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_events_user_id_idx ON login_events (user_id, id DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS login_events 
+  DROP CONSTRAINT IF EXISTS fk_login_event_users;
@@ -0,0 +1,2 @@
+ALTER TABLE login_events
+    ADD CONSTRAINT fk_login_event_users FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
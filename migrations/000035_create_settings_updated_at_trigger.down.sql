@@ -0,0 +1 @@
+DROP TRIGGER IF EXISTS settings_updated_at_trigger ON settings;
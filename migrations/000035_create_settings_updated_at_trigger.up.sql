@@ -0,0 +1,6 @@
+CREATE OR REPLACE TRIGGER settings_updated_at_trigger
+    BEFORE UPDATE
+    ON
+        settings
+    FOR EACH ROW
+EXECUTE PROCEDURE auto_set_update_at();
@@ -0,0 +1,3 @@
+-- Incremented by admin and profile writes only, unlike updated_at, so that logins and
+-- other internal writes don't change the ETag of a user
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version int NOT NULL DEFAULT 1;